@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// how many requests are read from the store at a time when exporting a bin
+	archiveChunkSize = 500
+	// the largest archive that can be imported, in bytes
+	maxArchiveSize = 32 << 20
+)
+
+// writeArchive writes every request in a bin to w as JSON Lines, one request per line, oldest
+// first. The requests are read a chunk at a time so that big bins aren't held in memory. It
+// returns the number of requests written.
+func writeArchive(w io.Writer, st Store, name string) (int, error) {
+	n := 0
+	q := historyQuery{Since: 0, Until: math.MaxInt64, Oldest: true, Limit: archiveChunkSize}
+	for {
+		vals, err := st.HistoryRange(name, q)
+		if err != nil {
+			return n, err
+		}
+
+		for _, v := range vals {
+			var gr struct {
+				Timestamp int64 `json:"timestamp"`
+			}
+			if err := json.Unmarshal([]byte(v), &gr); err != nil {
+				return n, err
+			}
+
+			// carry on from the last timestamp written rather than from an offset into the
+			// whole bin, so that requests dropped from the front of a busy bin while it's
+			// being exported don't make us skip any
+			if gr.Timestamp == q.Since {
+				q.Offset++
+			} else {
+				q.Since, q.Offset = gr.Timestamp, 1
+			}
+
+			if _, err := io.WriteString(w, v+"\n"); err != nil {
+				return n, err
+			}
+			n++
+		}
+
+		if len(vals) < archiveChunkSize {
+			return n, nil
+		}
+	}
+}
+
+// readArchive reads the requests in a JSON Lines archive written by writeArchive. Each request
+// keeps its timestamp, headers and body. If reparse is true, the geo data is found again from the
+// body rather than taken from the archive.
+func readArchive(r io.Reader, reparse bool) ([]*GeobinRequest, error) {
+	reqs := make([]*GeobinRequest, 0)
+	dec := json.NewDecoder(r)
+	for i := 1; ; i++ {
+		gr := new(GeobinRequest)
+		if err := dec.Decode(gr); err == io.EOF {
+			return reqs, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid request %d: %v", i, err)
+		}
+
+		if gr.Timestamp <= 0 {
+			return nil, fmt.Errorf("request %d has no timestamp", i)
+		}
+
+		if reparse {
+			gr = NewGeobinRequest(gr.Timestamp, gr.Headers, []byte(gr.Body))
+		}
+		reqs = append(reqs, gr)
+	}
+}
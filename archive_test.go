@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestWriteArchive(t *testing.T) {
+	st := NewMemoryStore()
+	assert.Equal(t, nil, st.CreateBin("bin_name", time.Hour))
+
+	// enough requests for a few chunks, with chunks starting part way through a second
+	n := archiveChunkSize*2 + 10
+	for i := 0; i < n; i++ {
+		encoded, err := json.Marshal(&GeobinRequest{Timestamp: int64(i/3 + 1), Body: fmt.Sprint(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, nil, addRequest(st, "bin_name", int64(i/3+1), string(encoded)))
+	}
+
+	var buf bytes.Buffer
+	written, err := writeArchive(&buf, st, "bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, n, written)
+
+	reqs, err := readArchive(&buf, false)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, n, len(reqs))
+	for i, gr := range reqs {
+		assert.Equal(t, fmt.Sprint(i), gr.Body)
+	}
+}
+
+func TestReadArchive(t *testing.T) {
+	archive := `{"timestamp":1400539133,"headers":{"Foo":"bar"},"body":"{\"lat\": 10, \"lng\": -10}"}
+{"timestamp":1400539134,"body":"{}","geo":[{"geo":{"type":"Point","coordinates":[1,2]},"path":[]}]}
+`
+	reqs, err := readArchive(strings.NewReader(archive), false)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(reqs))
+	assert.Equal(t, int64(1400539133), reqs[0].Timestamp)
+	assert.Equal(t, map[string]string{"Foo": "bar"}, reqs[0].Headers)
+	assert.Equal(t, 0, len(reqs[0].Geo))
+	assert.Equal(t, 1, len(reqs[1].Geo))
+
+	// reparsing finds the geo in the first request and drops the stale geo in the second
+	reqs, err = readArchive(strings.NewReader(archive), true)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(reqs[0].Geo))
+	assert.Equal(t, 0, len(reqs[1].Geo))
+
+	for _, a := range []string{
+		`{"timestamp":1400539133,"body":"{}"`,
+		`{"body":"{}"}`,
+		`[1, 2]`,
+	} {
+		_, err = readArchive(strings.NewReader(a), false)
+		assert.NotEqual(t, nil, err)
+	}
+}
+
+func TestExportImportHandlers(t *testing.T) {
+	be := newMemoryBackend()
+	gbs := NewGeobinServer(testConf, be.Store, be.PubSubber, NewSocketMap(be.PubSubber))
+	bins, _ := createBins(gbs, []int{3}, t)
+
+	post := func(url string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "http://testing.geobin.io"+url, strings.NewReader(body))
+		if err != nil {
+			t.Error(err)
+		}
+		w := httptest.NewRecorder()
+		gbs.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/api/1/bins/"+bins[0]+"/export", "")
+	assertResponseOK(w, t)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	archive := w.Body.String()
+	assert.Equal(t, 3, strings.Count(archive, "\n"))
+
+	w = post("/api/1/import?parse=true", archive)
+	assertResponseOK(w, t)
+	var js map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &js); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, float64(3), js["count"])
+	assert.NotEqual(t, bins[0], js["id"])
+
+	// the new bin holds exactly what the old one did
+	w = post("/api/1/bins/"+js["id"].(string)+"/export", "")
+	assertResponseOK(w, t)
+	assert.Equal(t, archive, w.Body.String())
+
+	assertResponseNotFound(post("/api/1/bins/unknown_bin/export", ""), t)
+	assertResponseCode(post("/api/1/import", `{"body":"{}"}`), http.StatusBadRequest, t)
+	assertResponseCode(post("/api/1/import?ttl=soon", archive), http.StatusBadRequest, t)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// bbox is a bounding box in lng/lat.
+type bbox struct {
+	MinLng, MinLat, MaxLng, MaxLat float64
+}
+
+// emptyBBox returns a bbox that contains nothing, and will contain exactly the first
+// position it is extended with.
+func emptyBBox() bbox {
+	return bbox{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+}
+
+// parseBBox parses a "minLng,minLat,maxLng,maxLat" string.
+func parseBBox(s string) (bbox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return bbox{}, errors.New("bbox must be in the form minLng,minLat,maxLng,maxLat")
+	}
+
+	var vals [4]float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return bbox{}, errors.New("bbox contains an invalid number: " + p)
+		}
+		vals[i] = v
+	}
+
+	b := bbox{vals[0], vals[1], vals[2], vals[3]}
+	if b.MinLng > b.MaxLng || b.MinLat > b.MaxLat {
+		return bbox{}, errors.New("bbox minimums must not be greater than its maximums")
+	}
+	return b, nil
+}
+
+// isEmpty returns true if the bbox hasn't been extended with any positions.
+func (b bbox) isEmpty() bool {
+	return b.MinLng > b.MaxLng
+}
+
+// extend grows the bbox to include the given position.
+func (b *bbox) extend(lng, lat float64) {
+	b.MinLng = math.Min(b.MinLng, lng)
+	b.MinLat = math.Min(b.MinLat, lat)
+	b.MaxLng = math.Max(b.MaxLng, lng)
+	b.MaxLat = math.Max(b.MaxLat, lat)
+}
+
+// intersects returns true if the two boxes overlap or touch.
+func (b bbox) intersects(o bbox) bool {
+	return b.MinLng <= o.MaxLng && b.MaxLng >= o.MinLng &&
+		b.MinLat <= o.MaxLat && b.MaxLat >= o.MinLat
+}
+
+// geoBounds returns the bounding box of all of the positions in the given geojson
+// object. The boolean is false if it contained no positions.
+func geoBounds(geo map[string]interface{}) (bbox, bool) {
+	b := emptyBBox()
+	extendGeoBounds(&b, geo)
+	return b, !b.isEmpty()
+}
+
+// extendGeoBounds recursively walks geometries, features and collections, extending
+// b with every position it finds.
+func extendGeoBounds(b *bbox, v interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for _, k := range []string{"coordinates", "geometry", "geometries", "features"} {
+			if c, ok := t[k]; ok {
+				extendGeoBounds(b, c)
+			}
+		}
+	case []interface{}:
+		// a position is an array that starts with two numbers
+		if len(t) >= 2 {
+			lng, lngOk := t[0].(float64)
+			lat, latOk := t[1].(float64)
+			if lngOk && latOk {
+				b.extend(lng, lat)
+				return
+			}
+		}
+
+		for _, c := range t {
+			extendGeoBounds(b, c)
+		}
+	}
+}
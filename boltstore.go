@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// how often the bolt store sweeps out expired bins
+const boltSweepInterval = time.Minute
+
+var (
+	// maps each bin name to its expiration time
+	boltBinsBucket = []byte("bins")
+	// holds a nested bucket of requests for each bin, keyed by the bin name
+	boltRequestsBucket = []byte("requests")
+	// maps each bin name to its boltUsage
+	boltUsageBucket = []byte("usage")
+)
+
+// boltStore is a Store that persists bins to a single bolt database file, so
+// Geobin can run as a single binary without a redis server. Requests are keyed
+// by their timestamp followed by a sequence number, which keeps them in the order
+// they were received. Expired bins are hidden as soon as they expire and removed
+// from the file by a background sweeper.
+type boltStore struct {
+	*memoryCounters
+	db   *bolt.DB
+	done chan struct{}
+}
+
+// NewBoltStore opens (or creates) the bolt database at path.
+func NewBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltBinsBucket, boltRequestsBucket, boltUsageBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	bs := &boltStore{
+		memoryCounters: newMemoryCounters(),
+		db:             db,
+		done:           make(chan struct{}),
+	}
+
+	go bs.sweep(boltSweepInterval)
+	return bs, nil
+}
+
+func (bs *boltStore) CreateBin(name string, ttl time.Duration) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		if boltBinIsLive(tx, name) {
+			return errors.New("A bin by that id already exists.")
+		}
+
+		// clear out anything left behind by an expired bin of the same name
+		if err := boltDeleteBin(tx, name); err != nil {
+			return err
+		}
+
+		if _, err := tx.Bucket(boltRequestsBucket).CreateBucket([]byte(name)); err != nil {
+			return err
+		}
+		return tx.Bucket(boltBinsBucket).Put([]byte(name), encodeBoltTime(time.Now().Add(ttl)))
+	})
+}
+
+func (bs *boltStore) BinExists(name string) (exists bool, err error) {
+	err = bs.db.View(func(tx *bolt.Tx) error {
+		exists = boltBinIsLive(tx, name)
+		return nil
+	})
+	return
+}
+
+func (bs *boltStore) AddRequest(name string, ts int64, encoded string, r retention) (dropped int64, err error) {
+	err = bs.db.Update(func(tx *bolt.Tx) error {
+		if !boltBinIsLive(tx, name) {
+			return errBinNotFound
+		}
+
+		b := tx.Bucket(boltRequestsBucket).Bucket([]byte(name))
+		u := getBoltUsage(tx, name)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		key := make([]byte, 16)
+		binary.BigEndian.PutUint64(key, uint64(ts))
+		binary.BigEndian.PutUint64(key[8:], seq)
+		if err = b.Put(key, []byte(encoded)); err != nil {
+			return err
+		}
+		u.count++
+		u.bytes += int64(len(encoded))
+
+		// drop the oldest requests until the bin is back within its limits
+		c := b.Cursor()
+		for k, v := c.First(); k != nil && r.exceeded(u.count, u.bytes); k, v = c.First() {
+			size := int64(len(v))
+			if err = c.Delete(); err != nil {
+				return err
+			}
+			u.count--
+			u.bytes -= size
+			dropped++
+		}
+		u.dropped += dropped
+
+		return putBoltUsage(tx, name, u)
+	})
+	return
+}
+
+func (bs *boltStore) History(name string) (history []string, err error) {
+	err = bs.db.View(func(tx *bolt.Tx) error {
+		if !boltBinIsLive(tx, name) {
+			return errBinNotFound
+		}
+
+		history = make([]string, 0)
+		c := tx.Bucket(boltRequestsBucket).Bucket([]byte(name)).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			history = append(history, string(v))
+		}
+		return nil
+	})
+	return
+}
+
+func (bs *boltStore) HistoryRange(name string, q historyQuery) (history []string, err error) {
+	err = bs.db.View(func(tx *bolt.Tx) error {
+		if !boltBinIsLive(tx, name) {
+			return errBinNotFound
+		}
+
+		history = make([]string, 0)
+		skipped := int64(0)
+		b := tx.Bucket(boltRequestsBucket).Bucket([]byte(name))
+		boltRange(b, q.Since, q.Until, q.Oldest, func(v []byte) bool {
+			if skipped < q.Offset {
+				skipped++
+				return true
+			}
+
+			history = append(history, string(v))
+			return q.Limit == 0 || int64(len(history)) < q.Limit
+		})
+		return nil
+	})
+	return
+}
+
+func (bs *boltStore) Count(name string) (count int64, err error) {
+	err = bs.db.View(func(tx *bolt.Tx) error {
+		if !boltBinIsLive(tx, name) {
+			return errBinNotFound
+		}
+
+		count = int64(tx.Bucket(boltRequestsBucket).Bucket([]byte(name)).Stats().KeyN)
+		return nil
+	})
+	return
+}
+
+func (bs *boltStore) CountRange(name string, since, until int64) (count int64, err error) {
+	err = bs.db.View(func(tx *bolt.Tx) error {
+		if !boltBinIsLive(tx, name) {
+			return errBinNotFound
+		}
+
+		b := tx.Bucket(boltRequestsBucket).Bucket([]byte(name))
+		boltRange(b, since, until, true, func(v []byte) bool {
+			count++
+			return true
+		})
+		return nil
+	})
+	return
+}
+
+func (bs *boltStore) Dropped(name string) (dropped int64, err error) {
+	err = bs.db.View(func(tx *bolt.Tx) error {
+		if !boltBinIsLive(tx, name) {
+			return errBinNotFound
+		}
+
+		dropped = getBoltUsage(tx, name).dropped
+		return nil
+	})
+	return
+}
+
+func (bs *boltStore) Expire(name string, ttl time.Duration) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		if !boltBinIsLive(tx, name) {
+			return errBinNotFound
+		}
+
+		return tx.Bucket(boltBinsBucket).Put([]byte(name), encodeBoltTime(time.Now().Add(ttl)))
+	})
+}
+
+func (bs *boltStore) TTL(name string) (ttl time.Duration, err error) {
+	err = bs.db.View(func(tx *bolt.Tx) error {
+		if !boltBinIsLive(tx, name) {
+			return errBinNotFound
+		}
+
+		ttl = decodeBoltTime(tx.Bucket(boltBinsBucket).Get([]byte(name))).Sub(time.Now())
+		return nil
+	})
+	return
+}
+
+func (bs *boltStore) DeleteBin(name string) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		if !boltBinIsLive(tx, name) {
+			return errBinNotFound
+		}
+
+		return boltDeleteBin(tx, name)
+	})
+}
+
+// Close stops the sweeper and closes the database file.
+func (bs *boltStore) Close() error {
+	close(bs.done)
+	return bs.db.Close()
+}
+
+// sweep periodically deletes expired bins from the database until the store is closed.
+func (bs *boltStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-bs.done:
+			return
+		case now := <-ticker.C:
+			if err := bs.deleteExpired(now); err != nil {
+				log.Println("Failure to sweep expired bins:", err)
+			}
+			bs.memoryCounters.sweep(now)
+		}
+	}
+}
+
+// deleteExpired deletes every bin that expired before now.
+func (bs *boltStore) deleteExpired(now time.Time) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		var expired []string
+		c := tx.Bucket(boltBinsBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if now.After(decodeBoltTime(v)) {
+				expired = append(expired, string(k))
+			}
+		}
+
+		for _, name := range expired {
+			debugLog("Sweeping expired bin:", name)
+			if err := boltDeleteBin(tx, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// boltBinIsLive returns true if the named bin exists and has not yet expired.
+func boltBinIsLive(tx *bolt.Tx, name string) bool {
+	v := tx.Bucket(boltBinsBucket).Get([]byte(name))
+	return v != nil && time.Now().Before(decodeBoltTime(v))
+}
+
+// boltDeleteBin removes a bin and all of its requests, if it exists.
+func boltDeleteBin(tx *bolt.Tx, name string) error {
+	if err := tx.Bucket(boltBinsBucket).Delete([]byte(name)); err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(boltUsageBucket).Delete([]byte(name)); err != nil {
+		return err
+	}
+
+	err := tx.Bucket(boltRequestsBucket).DeleteBucket([]byte(name))
+	if err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+	return nil
+}
+
+// boltUsage keeps track of how much a bin holds, so its retention limits can be
+// checked without going through all of its requests.
+type boltUsage struct {
+	count, bytes, dropped int64
+}
+
+// getBoltUsage returns the usage of a live bin. Bins created before usage was kept
+// track of have theirs worked out from their requests.
+func getBoltUsage(tx *bolt.Tx, name string) boltUsage {
+	var u boltUsage
+	if v := tx.Bucket(boltUsageBucket).Get([]byte(name)); v != nil {
+		u.count = int64(binary.BigEndian.Uint64(v))
+		u.bytes = int64(binary.BigEndian.Uint64(v[8:]))
+		u.dropped = int64(binary.BigEndian.Uint64(v[16:]))
+		return u
+	}
+
+	tx.Bucket(boltRequestsBucket).Bucket([]byte(name)).ForEach(func(k, v []byte) error {
+		u.count++
+		u.bytes += int64(len(v))
+		return nil
+	})
+	return u
+}
+
+func putBoltUsage(tx *bolt.Tx, name string, u boltUsage) error {
+	v := make([]byte, 24)
+	binary.BigEndian.PutUint64(v, uint64(u.count))
+	binary.BigEndian.PutUint64(v[8:], uint64(u.bytes))
+	binary.BigEndian.PutUint64(v[16:], uint64(u.dropped))
+	return tx.Bucket(boltUsageBucket).Put([]byte(name), v)
+}
+
+// boltRange calls fn with each of the requests in b that were received between since
+// and until (inclusive), oldest first if oldest is true or newest first if it isn't,
+// until fn returns false.
+func boltRange(b *bolt.Bucket, since, until int64, oldest bool, fn func(v []byte) bool) {
+	if since < 0 {
+		since = 0
+	}
+	if until < since {
+		return
+	}
+
+	c := b.Cursor()
+	if oldest {
+		for k, v := c.Seek(boltTimeKey(since)); k != nil && boltKeyTime(k) <= until; k, v = c.Next() {
+			if !fn(v) {
+				return
+			}
+		}
+		return
+	}
+
+	// find the first request received after until, then step back from there
+	var k, v []byte
+	if until == math.MaxInt64 {
+		k, v = c.Last()
+	} else if k, v = c.Seek(boltTimeKey(until + 1)); k == nil {
+		k, v = c.Last()
+	} else {
+		k, v = c.Prev()
+	}
+
+	for ; k != nil && boltKeyTime(k) >= since; k, v = c.Prev() {
+		if !fn(v) {
+			return
+		}
+	}
+}
+
+// boltTimeKey returns the prefix of the keys of the requests received at ts.
+func boltTimeKey(ts int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(ts))
+	return b
+}
+
+// boltKeyTime returns the time a request was received from its key.
+func boltKeyTime(k []byte) int64 {
+	return int64(binary.BigEndian.Uint64(k[:8]))
+}
+
+func encodeBoltTime(t time.Time) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(t.UnixNano()))
+	return b
+}
+
+func decodeBoltTime(b []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+}
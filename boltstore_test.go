@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestBoltStoreBins(t *testing.T) {
+	path, cleanup := tempDBPath(t)
+	defer cleanup()
+
+	bs, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, errBinNotFound, addRequest(bs, "bin_name", 1, "one"))
+	assert.Equal(t, nil, bs.CreateBin("bin_name", time.Hour))
+	assert.NotEqual(t, nil, bs.CreateBin("bin_name", time.Hour))
+
+	history, err := bs.History("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{}, history)
+
+	assert.Equal(t, nil, addRequest(bs, "bin_name", 2, "two"))
+	assert.Equal(t, nil, addRequest(bs, "bin_name", 1, "one"))
+	assert.Equal(t, nil, addRequest(bs, "bin_name", 2, "two again"))
+
+	// bins should survive the store being closed and opened again
+	assert.Equal(t, nil, bs.Close())
+	bs, err = NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bs.Close()
+
+	exists, err := bs.BinExists("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, exists)
+
+	history, err = bs.History("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"two again", "two", "one"}, history)
+
+	count, err := bs.Count("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(3), count)
+
+	_, err = bs.Count("unknown_bin_name")
+	assert.Equal(t, errBinNotFound, err)
+
+	assert.Equal(t, nil, bs.DeleteBin("bin_name"))
+	assert.Equal(t, errBinNotFound, bs.DeleteBin("bin_name"))
+	exists, err = bs.BinExists("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, exists)
+}
+
+func TestBoltStoreExpire(t *testing.T) {
+	path, cleanup := tempDBPath(t)
+	defer cleanup()
+
+	bs, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bs.Close()
+
+	assert.Equal(t, nil, bs.CreateBin("expired", time.Hour))
+	assert.Equal(t, nil, addRequest(bs, "expired", 1, "one"))
+	assert.Equal(t, nil, bs.Expire("expired", -time.Second))
+	assert.Equal(t, nil, bs.CreateBin("live", time.Hour))
+
+	exists, err := bs.BinExists("expired")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, exists)
+
+	// the sweeper should remove the expired bin and leave the live one alone
+	assert.Equal(t, nil, bs.deleteExpired(time.Now()))
+	exists, err = bs.BinExists("live")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, exists)
+
+	// a new bin with the same name as an expired one starts out empty
+	assert.Equal(t, nil, bs.CreateBin("expired", time.Hour))
+	count, err := bs.Count("expired")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func tempDBPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "geobin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filepath.Join(dir, "geobin.db"), func() {
+		os.RemoveAll(dir)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"time"
 )
 
 const (
@@ -11,18 +12,51 @@ const (
 	configFile = "./config.json"
 	// Requests per second
 	rateLimit = 1
+
+	// Supported values for the Store config key
+	storeRedis  = "redis"
+	storeMemory = "memory"
+	storeBolt   = "bolt"
+	storeSQLite = "sqlite"
+
+	// Default lifetime of a new bin, and the longest lifetime a bin can be given
+	defaultBinTTL    = 48 * time.Hour
+	defaultMaxBinTTL = 7 * 24 * time.Hour
+	// Default for how long before a bin expires its websockets are warned about it
+	defaultExpiryWarning = 5 * time.Minute
+
+	// Default path of the database file used by the bolt store
+	defaultBoltPath = "./geobin.db"
+	// Default path of the database file used by the sqlite store
+	defaultSQLitePath = "./geobin.sqlite"
 )
 
 // Config holds configuration values read in from the config file
 type Config struct {
 	Host       string
 	Port       int
+	Store      string
 	RedisHost  string
 	RedisPass  string
 	RedisDB    int64
+	BoltPath   string
+	SQLitePath string
 	NameVals   string
 	NameLength int
-	RateLimit  int
+	// Bin lifetimes, in seconds
+	BinTTL    int64
+	MaxBinTTL int64
+	// How long before a bin expires its websockets are warned about it, in seconds.
+	// Negative values turn the warnings off.
+	ExpiryWarning int64
+	// The most requests, and bytes of requests, each bin can hold before its oldest
+	// requests are dropped. Zero or negative values, the default, mean no limit.
+	MaxBinRequests int64
+	MaxBinBytes    int64
+	// Keys that strings are decoded as encoded polylines under, such as "polyline",
+	// "overview_polyline.points" or "shape:6". See parsePolylineKeys.
+	PolylineKeys []string
+	RateLimit    int
 }
 
 // loadConfig reads configuration values from the config file
@@ -39,6 +73,56 @@ func loadConfig() *Config {
 		log.Fatal(err)
 	}
 
+	if conf.Store == "" {
+		conf.Store = storeRedis
+	}
+
+	if conf.BoltPath == "" {
+		conf.BoltPath = defaultBoltPath
+	}
+
+	if conf.SQLitePath == "" {
+		conf.SQLitePath = defaultSQLitePath
+	}
+
+	if conf.BinTTL == 0 {
+		conf.BinTTL = int64(defaultBinTTL / time.Second)
+	}
+
+	if conf.MaxBinTTL == 0 {
+		conf.MaxBinTTL = int64(defaultMaxBinTTL / time.Second)
+	}
+
+	if conf.ExpiryWarning == 0 {
+		conf.ExpiryWarning = int64(defaultExpiryWarning / time.Second)
+	}
+
+	if len(conf.PolylineKeys) == 0 {
+		conf.PolylineKeys = defaultPolylineKeys
+	}
+
 	conf.RateLimit = rateLimit
 	return &conf
 }
+
+// boundTTL returns the given bin lifetime, cut down to MaxBinTTL if it's longer than that.
+func (c *Config) boundTTL(ttl time.Duration) time.Duration {
+	if max := time.Duration(c.MaxBinTTL) * time.Second; ttl > max {
+		return max
+	}
+	return ttl
+}
+
+// binTTL returns the lifetime of bins that aren't asked for one, which is BinTTL, cut down to
+// MaxBinTTL like any other lifetime.
+func (c *Config) binTTL() time.Duration {
+	return c.boundTTL(time.Duration(c.BinTTL) * time.Second)
+}
+
+// retention returns the limits on how much each bin can hold.
+func (c *Config) retention() retention {
+	return retention{
+		MaxRequests: c.MaxBinRequests,
+		MaxBytes:    c.MaxBinBytes,
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The interpretations isOtherGeo and parseString record on the geos they find in strings, so that
+// it's clear how a string was read.
+const (
+	// numbers written as strings, such as {"lat": "45.52", "lng": "-122.68"}
+	interpNumericString = "numeric-string"
+	// a string of two numbers, latitude first, such as "45.52,-122.68"
+	interpLatLngString = "lat-lng-string"
+	// a string of two numbers, longitude first, such as "-122.68 45.52"
+	interpLngLatString = "lng-lat-string"
+	// degrees, minutes and seconds, or a hemisphere, such as "45°31'12\"N 122°40'48\"W"
+	interpDMS = "dms"
+)
+
+var errNotDMS = errors.New("not in degrees, minutes and seconds")
+
+// dmsAngle is an angle written in degrees, minutes and seconds, or with a hemisphere letter.
+type dmsAngle struct {
+	// the degrees, minutes and seconds, as many of them as were written
+	parts []float64
+	// whether the angle was written with a minus sign
+	negative bool
+	// N, S, E or W, if the angle was written with one
+	hemisphere byte
+}
+
+// dmsUnits maps the symbols that can follow the parts of an angle to the part they follow, which
+// is 0 for degrees, 1 for minutes and 2 for seconds.
+var dmsUnits = map[rune]int{
+	'°': 0, 'º': 0, '˚': 0,
+	'\'': 1, '′': 1, '’': 1,
+	'"': 2, '″': 2, '”': 2,
+}
+
+// parseCoordinate reads a latitude or longitude, which is a number, a string holding a number, or
+// a string in degrees, minutes and seconds, which may have a hemisphere letter, N or S for a
+// latitude and E or W for a longitude. It returns the interpretation it used for a string.
+func parseCoordinate(v interface{}, isLat bool) (float64, string, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, "", true
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(t), 64); err == nil {
+			return f, interpNumericString, true
+		}
+
+		angles, err := parseDMS(t)
+		if err != nil || len(angles) != 1 {
+			return 0, "", false
+		}
+		if h := angles[0].hemisphere; h != 0 && (h == 'N' || h == 'S') != isLat {
+			return 0, "", false
+		}
+
+		f, ok := angles[0].degrees()
+		return f, interpDMS, ok
+	}
+	return 0, "", false
+}
+
+// parseCoordinatePair reads a latitude and longitude written together in a string. A pair in
+// degrees, minutes and seconds is taken to be latitude first, unless its hemisphere letters say
+// otherwise. A pair of plain numbers, separated by a comma or spaces, is taken to be latitude
+// first unless lngFirst is set, or only the other order gives a valid position.
+func parseCoordinatePair(s string, lngFirst bool) (lng, lat float64, interp string, ok bool) {
+	if lng, lat, err := parseDMSPair(s); err == nil {
+		return lng, lat, interpDMS, true
+	} else if err != errNotDMS {
+		return 0, 0, "", false
+	}
+
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t'
+	})
+	if len(fields) != 2 {
+		return 0, 0, "", false
+	}
+
+	a, aErr := strconv.ParseFloat(fields[0], 64)
+	b, bErr := strconv.ParseFloat(fields[1], 64)
+	if aErr != nil || bErr != nil {
+		return 0, 0, "", false
+	}
+
+	latFirst := latIsValid(a) && lngIsValid(b)
+	lngFirstValid := lngIsValid(a) && latIsValid(b)
+	switch {
+	case latFirst && (!lngFirst || !lngFirstValid):
+		return b, a, interpLatLngString, true
+	case lngFirstValid:
+		return a, b, interpLngLatString, true
+	}
+	return 0, 0, "", false
+}
+
+// parseDMSPair reads a latitude and longitude in degrees, minutes and seconds, such as
+// 45°31'12"N 122°40'48"W. It returns errNotDMS if the string isn't written that way.
+func parseDMSPair(s string) (float64, float64, error) {
+	angles, err := parseDMS(s)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(angles) != 2 {
+		return 0, 0, errNotDMS
+	}
+
+	lat, lng := angles[0], angles[1]
+	isLat := func(a dmsAngle) bool { return a.hemisphere == 'N' || a.hemisphere == 'S' }
+	isLng := func(a dmsAngle) bool { return a.hemisphere == 'E' || a.hemisphere == 'W' }
+	if isLng(lat) || isLat(lng) {
+		lat, lng = lng, lat
+	}
+	if isLng(lat) || isLat(lng) {
+		return 0, 0, errPositionOutOfRange
+	}
+
+	y, latOK := lat.degrees()
+	x, lngOK := lng.degrees()
+	if !latOK || !lngOK || !latIsValid(y) || !lngIsValid(x) {
+		return 0, 0, errPositionOutOfRange
+	}
+	return x, y, nil
+}
+
+// parseDMS splits a string into the angles written in it in degrees, minutes and seconds. The
+// parts of each angle can be marked with symbols like ° ' and ", or separated by spaces, and each
+// angle can have a hemisphere letter before or after it. Angles are separated by commas, by their
+// hemisphere letters, or by starting over at degrees. It returns errNotDMS if the string has
+// anything else in it, or has no symbols or hemisphere letters, since then it's just numbers.
+func parseDMS(s string) ([]dmsAngle, error) {
+	s = strings.TrimSpace(s)
+	// hemisphere letters come either before all the angles or after all of them
+	prefixed := len(s) > 0 && strings.IndexByte("NSEWnsew", s[0]) >= 0
+
+	angles := make([]dmsAngle, 0, 2)
+	var cur dmsAngle
+	var marked bool
+	finish := func() {
+		if len(cur.parts) > 0 {
+			angles = append(angles, cur)
+		}
+		cur = dmsAngle{}
+	}
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == ' ' || r == '\t':
+			i += size
+		case r == ',' || r == ';':
+			finish()
+			i += size
+		case strings.ContainsRune("NSEWnsew", r):
+			// a letter before an angle starts it, and a letter after one finishes it
+			h := byte(r) &^ 0x20
+			if prefixed {
+				if cur.hemisphere != 0 && len(cur.parts) == 0 {
+					return nil, errNotDMS
+				}
+				finish()
+				cur.hemisphere = h
+			} else {
+				if len(cur.parts) == 0 {
+					return nil, errNotDMS
+				}
+				cur.hemisphere = h
+				finish()
+			}
+			marked = true
+			i += size
+		case r == '-' || r == '+' || r == '.' || (r >= '0' && r <= '9'):
+			j := i + 1
+			for j < len(s) && (s[j] == '.' || (s[j] >= '0' && s[j] <= '9')) {
+				j++
+			}
+			f, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return nil, errNotDMS
+			}
+			i = j
+
+			// the symbol after the number, if there is one, says which part it is. Two single
+			// quotes are sometimes used for seconds.
+			for i < len(s) && s[i] == ' ' {
+				i++
+			}
+			unit := -1
+			if strings.HasPrefix(s[i:], "''") {
+				unit = 2
+				i += 2
+			} else if r, size := utf8.DecodeRuneInString(s[i:]); i < len(s) {
+				if u, ok := dmsUnits[r]; ok {
+					unit = u
+					i += size
+				}
+			}
+			if unit >= 0 {
+				marked = true
+			}
+
+			// a number starts a new angle if it has a sign, is in degrees, or comes after seconds
+			signed := r == '-' || r == '+'
+			if len(cur.parts) > 0 && (signed || unit == 0 || len(cur.parts) == 3 || (unit > 0 && unit < len(cur.parts))) {
+				finish()
+			}
+			if unit < 0 {
+				unit = len(cur.parts)
+			}
+			if unit != len(cur.parts) {
+				return nil, errNotDMS
+			}
+
+			if len(cur.parts) == 0 && f < 0 {
+				cur.negative = true
+				f = -f
+			}
+			cur.parts = append(cur.parts, f)
+		default:
+			return nil, errNotDMS
+		}
+	}
+	finish()
+
+	if !marked || len(angles) == 0 {
+		return nil, errNotDMS
+	}
+	return angles, nil
+}
+
+// degrees returns the angle in decimal degrees, checking that its minutes and seconds are under
+// 60, and only the last of its parts has a fraction.
+func (a dmsAngle) degrees() (float64, bool) {
+	var d float64
+	for i, p := range a.parts {
+		if p < 0 || (i > 0 && p >= 60) || (i < len(a.parts)-1 && p != math.Floor(p)) {
+			return 0, false
+		}
+		d += p / math.Pow(60, float64(i))
+	}
+
+	negative := a.negative
+	if a.hemisphere == 'S' || a.hemisphere == 'W' {
+		if negative {
+			return 0, false
+		}
+		negative = true
+	}
+	if negative {
+		d = -d
+	}
+	return d, true
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestParseCoordinate(t *testing.T) {
+	for _, test := range []struct {
+		v      interface{}
+		isLat  bool
+		exp    float64
+		interp string
+	}{
+		{float64(45.52), true, 45.52, ""},
+		{" -122.68 ", false, -122.68, interpNumericString},
+		{`45°31'12"N`, true, 45.52, interpDMS},
+		{`45°31'12"S`, true, -45.52, interpDMS},
+		{"122°40′48″W", false, -122.68, interpDMS},
+		{"W 122 40 48", false, -122.68, interpDMS},
+		{"45.52° N", true, 45.52, interpDMS},
+		{"-45°31.2'", true, -45.52, interpDMS},
+		{`45°31'12''`, true, 45.52, interpDMS},
+	} {
+		f, interp, ok := parseCoordinate(test.v, test.isLat)
+		assert.Equal(t, true, ok, test.v)
+		assertNear(t, []float64{test.exp}, []float64{f}, 1e-9)
+		assert.Equal(t, test.interp, interp, test.v)
+	}
+
+	for _, test := range []struct {
+		v     interface{}
+		isLat bool
+	}{
+		{`45°31'12"E`, true},   // E is for longitudes
+		{`122°40'48"N`, false}, // N is for latitudes
+		{`-45°31'12"S`, true},  // negative twice
+		{`45°61'12"N`, true},   // 61 minutes
+		{`45.5°31'N`, true},    // fractional degrees with minutes
+		{`31'12"N`, true},      // no degrees
+		{"forty five", true},
+		{"", true},
+		{true, true},
+	} {
+		_, _, ok := parseCoordinate(test.v, test.isLat)
+		assert.Equal(t, false, ok, test.v)
+	}
+}
+
+func TestParseCoordinatePair(t *testing.T) {
+	for _, test := range []struct {
+		s        string
+		lngFirst bool
+		lng, lat float64
+		interp   string
+	}{
+		{"45.52,-122.68", false, -122.68, 45.52, interpLatLngString},
+		{"45.52, -122.68", false, -122.68, 45.52, interpLatLngString},
+		{"45.52 -122.68", false, -122.68, 45.52, interpLatLngString},
+		{"45.52,-12.68", true, 45.52, -12.68, interpLngLatString},
+		// only valid longitude first
+		{"-122.68,45.52", false, -122.68, 45.52, interpLngLatString},
+		// only valid latitude first
+		{"45.52,-122.68", true, -122.68, 45.52, interpLatLngString},
+		{`45°31'12"N 122°40'48"W`, false, -122.68, 45.52, interpDMS},
+		{`45°31'12"N, 122°40'48"W`, false, -122.68, 45.52, interpDMS},
+		{`122°40'48"W 45°31'12"N`, false, -122.68, 45.52, interpDMS},
+		{"N45 31 12 W122 40 48", false, -122.68, 45.52, interpDMS},
+		{"45°31.2' -122°40.8'", false, -122.68, 45.52, interpDMS},
+		{"45.52°N 122.68°W", false, -122.68, 45.52, interpDMS},
+	} {
+		lng, lat, interp, ok := parseCoordinatePair(test.s, test.lngFirst)
+		assert.Equal(t, true, ok, test.s)
+		assertNear(t, []float64{test.lng, test.lat}, []float64{lng, lat}, 1e-9)
+		assert.Equal(t, test.interp, interp, test.s)
+	}
+
+	for _, s := range []string{
+		"45.52",
+		"45.52,-122.68,10",
+		"145.52,-122.68",
+		`45°31'12"N 46°31'12"S`,
+		`95°N 122°W`,
+		"12 W 34th St",
+		"12:30",
+	} {
+		_, _, _, ok := parseCoordinatePair(s, false)
+		assert.Equal(t, false, ok, s)
+	}
+}
+
+func TestIsOtherGeoStrings(t *testing.T) {
+	for _, test := range []struct {
+		o      map[string]interface{}
+		interp string
+	}{
+		{map[string]interface{}{"lat": "45.52", "lng": "-122.68"}, interpNumericString},
+		{map[string]interface{}{"lat": float64(45.52), "lng": "-122.68"}, interpNumericString},
+		{map[string]interface{}{"lat": `45°31'12"N`, "lng": "-122.68"}, interpDMS},
+		{map[string]interface{}{"position": "45.52,-122.68"}, interpLatLngString},
+		{map[string]interface{}{"lonlat": "-122.68 45.52"}, interpLngLatString},
+		{map[string]interface{}{"location": `45°31'12"N 122°40'48"W`}, interpDMS},
+		{map[string]interface{}{"coordinates": []interface{}{-122.68, 45.52}}, ""},
+		{map[string]interface{}{"latlng": []interface{}{45.52, -122.68}}, ""},
+	} {
+		found, g := isOtherGeo(test.o)
+		assert.Equal(t, true, found, test.o)
+		assert.Equal(t, test.interp, g.Interpretation, test.o)
+
+		coords := g.Geo["coordinates"].([]interface{})
+		assertNear(t, []float64{-122.68, 45.52}, []float64{coords[0].(float64), coords[1].(float64)}, 1e-9)
+	}
+
+	for _, o := range []map[string]interface{}{
+		{"lat": "north", "lng": "-122.68"},
+		{"lat": "45.52"},
+		{"position": "45.52"},
+		{"coordinates": []interface{}{"-122.68", "45.52"}},
+	} {
+		found, _ := isOtherGeo(o)
+		assert.Equal(t, false, found, o)
+	}
+}
+
+func TestParseDMSInRequest(t *testing.T) {
+	gr := NewGeobinRequest(0, nil, []byte(`{"summit": "45°22'26\"N 121°41'45\"W", "note": "N of the lodge"}`))
+
+	assert.Equal(t, 1, len(gr.Geo))
+	assert.Equal(t, []interface{}{"summit"}, gr.Geo[0].Path)
+	assert.Equal(t, interpDMS, gr.Geo[0].Interpretation)
+
+	coords := gr.Geo[0].Geo["coordinates"].([]interface{})
+	assertNear(t, []float64{-121.695833, 45.373889}, []float64{coords[0].(float64), coords[1].(float64)}, 1e-6)
+}
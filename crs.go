@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The SRIDs of WGS84 longitude and latitude, which is what GeoJSON uses, and of Web Mercator,
+// which is what most web maps use.
+const (
+	sridWGS84       = 4326
+	sridWebMercator = 3857
+)
+
+const (
+	// webMercatorBound is how far Web Mercator coordinates go from its origin, in meters, both
+	// east and west and north and south
+	webMercatorBound = 20037508.342789244
+	// minProjectedValue is the smallest coordinate we take to be sure of being projected meters
+	// rather than degrees
+	minProjectedValue = 1000000
+)
+
+// sridTransforms maps the SRIDs we know how to convert to WGS84 to the function that does it.
+// The UTM zones and state planes are added by init.
+var sridTransforms = map[int]func(x, y float64) (lng, lat float64){
+	sridWebMercator: webMercatorToWGS84,
+	3785:            webMercatorToWGS84,
+	900913:          webMercatorToWGS84,
+	102100:          webMercatorToWGS84,
+	102113:          webMercatorToWGS84,
+}
+
+// crsNamePattern matches the names of coordinate reference systems in GeoJSON crs members, which
+// are either short, like "EPSG:3857", or OGC URNs or URLs, like "urn:ogc:def:crs:EPSG::3857".
+var crsNamePattern = regexp.MustCompile(`^(?:URN:OGC:DEF:CRS:)?(EPSG|ESRI):(?:[\d.]*:)?(\d+)$|^HTTPS?://WWW\.OPENGIS\.NET/DEF/CRS/(EPSG|ESRI)/[\d.]+/(\d+)$`)
+
+var errPositionOutOfRange = errors.New("position out of range")
+
+func init() {
+	// WGS84 / UTM zones, north and south, and NAD83 / UTM zones, which only cover North America
+	for zone := 1; zone <= 60; zone++ {
+		sridTransforms[32600+zone] = utmTransform(zone, true)
+		sridTransforms[32700+zone] = utmTransform(zone, false)
+	}
+	for zone := 1; zone <= 23; zone++ {
+		sridTransforms[26900+zone] = utmTransform(zone, true)
+	}
+
+	for srid, p := range statePlanes {
+		sridTransforms[srid] = p.toWGS84
+	}
+}
+
+// webMercatorToWGS84 converts Web Mercator meters to WGS84 longitude and latitude.
+func webMercatorToWGS84(x, y float64) (float64, float64) {
+	const r = 6378137.0
+	lng := x / r * 180 / math.Pi
+	lat := (2*math.Atan(math.Exp(y/r)) - math.Pi/2) * 180 / math.Pi
+	return lng, lat
+}
+
+// utmTransform returns a function that converts eastings and northings in the given UTM zone
+// to WGS84.
+func utmTransform(zone int, north bool) func(x, y float64) (float64, float64) {
+	return func(x, y float64) (float64, float64) {
+		return utmToWGS84(zone, north, x, y)
+	}
+}
+
+// crsName returns the name we give the coordinate reference system with the given SRID. Esri's
+// own well-known IDs, such as 102100, are all above 100000.
+func crsName(srid int) string {
+	if srid >= 100000 {
+		return fmt.Sprintf("ESRI:%d", srid)
+	}
+	return fmt.Sprintf("EPSG:%d", srid)
+}
+
+// geojsonSRID returns the SRID of the coordinate reference system named by the crs member of a
+// GeoJSON object, which RFC 7946 dropped but older GeoJSON often has, or zero if it doesn't have
+// one we can read. Both named crs members and the old EPSG type, with a code, are read. OGC's
+// CRS84 is WGS84 longitude and latitude.
+func geojsonSRID(o map[string]interface{}) int {
+	crs, _ := o["crs"].(map[string]interface{})
+	props, _ := crs["properties"].(map[string]interface{})
+
+	switch crs["type"] {
+	case "name":
+		name, _ := props["name"].(string)
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if strings.HasSuffix(name, "CRS84") {
+			return sridWGS84
+		}
+
+		m := crsNamePattern.FindStringSubmatch(name)
+		if m == nil {
+			return 0
+		}
+		// only one of the patterns matches, so the other's code is empty
+		srid, _ := strconv.Atoi(m[2] + m[4])
+		return srid
+	case "EPSG":
+		code, _ := props["code"].(float64)
+		return int(code)
+	}
+	return 0
+}
+
+// looksWebMercator returns true if the coordinates of a GeoJSON object are obviously Web Mercator
+// meters rather than longitude and latitude: all of them are within Web Mercator's bounds, and at
+// least one of them is more than 1000km west or south of its origin. UTM zones, state planes and
+// national grids have false eastings and northings that keep them positive wherever they're used,
+// so large positive values alone could be any of them, and aren't taken to be Web Mercator.
+func looksWebMercator(geo map[string]interface{}) bool {
+	var projected bool
+	err := eachGeometryPosition(geo, func(pos []interface{}) error {
+		for _, v := range pos[:2] {
+			f, ok := v.(float64)
+			if !ok || math.Abs(f) > webMercatorBound {
+				return errPositionOutOfRange
+			}
+			if f <= -minProjectedValue {
+				projected = true
+			}
+		}
+		return nil
+	})
+	return err == nil && projected
+}
+
+// transformGeometry converts the coordinates of a GeoJSON object from the given SRID to
+// WGS84 in place. An SRID of zero is taken to mean WGS84. It returns false if it doesn't know
+// how to convert from the SRID, and an error if any of the converted coordinates aren't a valid
+// longitude and latitude. Either way, the object is left as it was.
+func transformGeometry(geo map[string]interface{}, srid int) (bool, error) {
+	fn := sridTransforms[srid]
+	if fn == nil && srid != 0 && srid != sridWGS84 {
+		return false, nil
+	}
+
+	positions := make([][]interface{}, 0)
+	converted := make([][2]float64, 0)
+	err := eachGeometryPosition(geo, func(pos []interface{}) error {
+		x, xok := pos[0].(float64)
+		y, yok := pos[1].(float64)
+		if !xok || !yok {
+			return errPositionOutOfRange
+		}
+
+		if fn != nil {
+			x, y = fn(x, y)
+		}
+
+		if !lngIsValid(x) || !latIsValid(y) {
+			return errPositionOutOfRange
+		}
+		positions = append(positions, pos)
+		converted = append(converted, [2]float64{x, y})
+		return nil
+	})
+	if err != nil {
+		return true, err
+	}
+
+	for i, pos := range positions {
+		pos[0], pos[1] = converted[i][0], converted[i][1]
+	}
+	return true, nil
+}
+
+// project converts geometry, the GeoJSON object of g, from the coordinate reference system with
+// the given SRID to WGS84. If the SRID isn't WGS84 it is recorded on g, and if we don't know how to
+// convert from it g is marked as untransformed. Without an SRID, coordinates that are obviously
+// Web Mercator are taken to be, and g is marked as having its CRS guessed.
+func (g *Geo) project(geometry map[string]interface{}, srid int) error {
+	guessed := srid == 0 && looksWebMercator(geometry)
+	if guessed {
+		srid = sridWebMercator
+	}
+
+	transformed, err := transformGeometry(geometry, srid)
+	if err != nil {
+		return err
+	}
+
+	if srid != 0 && srid != sridWGS84 {
+		g.CRS = crsName(srid)
+		g.CRSGuessed = guessed
+		g.Untransformed = !transformed
+	}
+	return nil
+}
+
+// eachGeometryPosition calls fn with every position in a GeoJSON geometry, Feature or
+// FeatureCollection, stopping at the first error.
+func eachGeometryPosition(geo map[string]interface{}, fn func([]interface{}) error) error {
+	if features, ok := geo["features"].([]interface{}); ok {
+		return eachGeometryPositionIn(features, fn)
+	}
+	if g, ok := geo["geometry"].(map[string]interface{}); ok {
+		return eachGeometryPosition(g, fn)
+	}
+	if geoms, ok := geo["geometries"].([]interface{}); ok {
+		return eachGeometryPositionIn(geoms, fn)
+	}
+
+	return eachPosition(geo["coordinates"], fn)
+}
+
+// eachGeometryPositionIn calls eachGeometryPosition with each of the GeoJSON objects in a.
+func eachGeometryPositionIn(a []interface{}, fn func([]interface{}) error) error {
+	for _, o := range a {
+		m, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if err := eachGeometryPosition(m, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachPosition calls fn with every position in a GeoJSON coordinates array of any depth.
+func eachPosition(coords interface{}, fn func([]interface{}) error) error {
+	a, ok := coords.([]interface{})
+	if !ok || len(a) == 0 {
+		return nil
+	}
+
+	if _, ok := a[0].([]interface{}); !ok {
+		if len(a) < 2 {
+			return errPositionOutOfRange
+		}
+		return fn(a)
+	}
+
+	for _, c := range a {
+		if err := eachPosition(c, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestGeojsonSRID(t *testing.T) {
+	for src, exp := range map[string]int{
+		`{"type": "name", "properties": {"name": "EPSG:3857"}}`:                                  3857,
+		`{"type": "name", "properties": {"name": "urn:ogc:def:crs:EPSG::32610"}}`:                32610,
+		`{"type": "name", "properties": {"name": "urn:ogc:def:crs:EPSG:6.6:2913"}}`:              2913,
+		`{"type": "name", "properties": {"name": "http://www.opengis.net/def/crs/EPSG/0/3857"}}`: 3857,
+		`{"type": "name", "properties": {"name": "ESRI:102100"}}`:                                102100,
+		`{"type": "name", "properties": {"name": "urn:ogc:def:crs:OGC:1.3:CRS84"}}`:              4326,
+		`{"type": "EPSG", "properties": {"code": 2263}}`:                                         2263,
+		`{"type": "link", "properties": {"href": "http://example.com/crs/42", "type": "proj4"}}`: 0,
+		`{"type": "name", "properties": {"name": "WGS 84"}}`:                                     0,
+		`"EPSG:3857"`: 0,
+	} {
+		var crs interface{}
+		if err := json.Unmarshal([]byte(src), &crs); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, exp, geojsonSRID(map[string]interface{}{"crs": crs}), src)
+	}
+}
+
+func TestLooksWebMercator(t *testing.T) {
+	for _, test := range []struct {
+		coords []interface{}
+		exp    bool
+	}{
+		{[]interface{}{-13627361.0, 5705271.0}, true},
+		{[]interface{}{-122.68, 45.52}, false},
+		// British National Grid, or anything else that's near enough its origin
+		{[]interface{}{530000.0, 180000.0}, false},
+		// UTM, and California zone 3 in feet, which are positive like every grid made to be used
+		// in its area
+		{[]interface{}{500000.0, 5000000.0}, false},
+		{[]interface{}{6000000.0, 2000000.0}, false},
+		// Sydney, south of the equator
+		{[]interface{}{16832000.0, -4011000.0}, true},
+		{[]interface{}{-13627361.0, 25705271.0}, false},
+	} {
+		geo := map[string]interface{}{"type": "Point", "coordinates": test.coords}
+		assert.Equal(t, test.exp, looksWebMercator(geo), test.coords)
+	}
+}
+
+func TestTransformGeometryOutOfRange(t *testing.T) {
+	// the second position isn't anywhere, so neither is converted
+	geo := map[string]interface{}{"type": "LineString", "coordinates": []interface{}{
+		[]interface{}{-13627361.0, 5705271.0},
+		[]interface{}{-23627361.0, 5705271.0},
+	}}
+	transformed, err := transformGeometry(geo, sridWebMercator)
+	assert.Equal(t, true, transformed)
+	assert.Equal(t, errPositionOutOfRange, err)
+	assert.Equal(t, []interface{}{-13627361.0, 5705271.0}, geo["coordinates"].([]interface{})[0])
+}
+
+func TestProjectedGeojsonInRequest(t *testing.T) {
+	gr := NewGeobinRequest(0, nil, []byte(`{
+		"mercator": {
+			"type": "FeatureCollection",
+			"crs": {"type": "name", "properties": {"name": "urn:ogc:def:crs:EPSG::3857"}},
+			"features": [{"type": "Feature", "properties": null, "geometry": {"type": "Point", "coordinates": [-13627361, 5705271]}}]
+		},
+		"utm": {
+			"type": "Point",
+			"crs": {"type": "name", "properties": {"name": "EPSG:32618"}},
+			"coordinates": [323483, 4306479]
+		},
+		"guessed": {"type": "LineString", "coordinates": [[-13627361, 5705271], [-13627000, 5705000]]},
+		"osgb": {
+			"type": "Point",
+			"crs": {"type": "name", "properties": {"name": "EPSG:27700"}},
+			"coordinates": [530000, 180000]
+		},
+		"xy": {"x": -13627361, "y": 5705271},
+		"utmRange": {"type": "Point", "coordinates": [500000, 5000000]},
+		"utmRangeXY": {"x": 500000, "y": 5000000}
+	}`))
+
+	assert.Equal(t, 6, len(gr.Geo))
+	for _, g := range gr.Geo {
+		switch g.Path[0] {
+		case "mercator":
+			assert.Equal(t, "EPSG:3857", g.CRS)
+			assert.Equal(t, false, g.CRSGuessed)
+			point := g.Geo["features"].([]interface{})[0].(map[string]interface{})["geometry"].(map[string]interface{})
+			coords := point["coordinates"].([]interface{})
+			assertNear(t, []float64{-122.4167, 45.5295}, []float64{coords[0].(float64), coords[1].(float64)}, 1e-3)
+		case "utm":
+			assert.Equal(t, "EPSG:32618", g.CRS)
+			coords := g.Geo["coordinates"].([]interface{})
+			assertNear(t, []float64{-77.03524, 38.88946}, []float64{coords[0].(float64), coords[1].(float64)}, 1e-5)
+		case "guessed":
+			assert.Equal(t, "EPSG:3857", g.CRS)
+			assert.Equal(t, true, g.CRSGuessed)
+			assert.Equal(t, 0, len(g.Diagnostics))
+		case "osgb":
+			assert.Equal(t, "EPSG:27700", g.CRS)
+			assert.Equal(t, true, g.Untransformed)
+			assert.Equal(t, []interface{}{float64(530000), float64(180000)}, g.Geo["coordinates"])
+		case "xy":
+			assert.Equal(t, "EPSG:3857", g.CRS)
+			assert.Equal(t, true, g.CRSGuessed)
+			coords := g.Geo["coordinates"].([]interface{})
+			assertNear(t, []float64{-122.4167, 45.5295}, []float64{coords[0].(float64), coords[1].(float64)}, 1e-3)
+		case "utmRange":
+			// without a crs, it isn't taken to be anything but bad longitudes and latitudes
+			assert.Equal(t, "", g.CRS)
+			assert.Equal(t, false, g.CRSGuessed)
+			assert.Equal(t, []interface{}{float64(500000), float64(5000000)}, g.Geo["coordinates"])
+			assert.NotEqual(t, 0, len(g.Diagnostics))
+		default:
+			t.Errorf("Unexpected geo at %v", g.Path)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var errNoCSVGeo = errors.New("no latitude and longitude or WKT columns in CSV header")
+
+// csvDelimiters are the delimiters CSV bodies may use. Spreadsheets exported in some locales use
+// semicolons or tabs rather than commas.
+var csvDelimiters = []rune{',', ';', '\t'}
+
+// csvColumns holds the indexes of the columns with geo data in them, or -1 for the ones that
+// aren't there.
+type csvColumns struct {
+	lat, lng, dst, wkt int
+}
+
+// csvHeaderLine returns the first line of body, which is the header row of a CSV document.
+func csvHeaderLine(body []byte) string {
+	if i := bytes.IndexByte(body, '\n'); i >= 0 {
+		body = body[:i]
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(string(body), "\ufeff"), "\r")
+}
+
+// csvDelimiter guesses which of csvDelimiters the header line uses, by which appears the most.
+func csvDelimiter(header string) rune {
+	delim, most := csvDelimiters[0], 0
+	for _, d := range csvDelimiters {
+		if n := strings.Count(header, string(d)); n > most {
+			delim, most = d, n
+		}
+	}
+	return delim
+}
+
+// findCSVColumns looks for columns in the CSV header with the same names as the keys isOtherGeo
+// looks for, or a column of WKT geometries named "wkt", "geom", "geometry", "the_geom" or "shape".
+// It returns false if there isn't both a latitude and a longitude column, or a WKT column.
+func findCSVColumns(header []string) (csvColumns, bool) {
+	cols := csvColumns{-1, -1, -1, -1}
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		switch otherGeoKey(h) {
+		case otherGeoLat:
+			if cols.lat < 0 {
+				cols.lat = i
+			}
+		case otherGeoLng:
+			if cols.lng < 0 {
+				cols.lng = i
+			}
+		case otherGeoDst:
+			if cols.dst < 0 {
+				cols.dst = i
+			}
+		}
+
+		switch strings.ToLower(h) {
+		case "wkt", "geom", "geometry", "the_geom", "shape":
+			if cols.wkt < 0 {
+				cols.wkt = i
+			}
+		}
+	}
+
+	return cols, (cols.lat >= 0 && cols.lng >= 0) || cols.wkt >= 0
+}
+
+// sniffCSV checks whether the first line of body is a CSV header with geo columns in it.
+func sniffCSV(body []byte) bool {
+	line := csvHeaderLine(body)
+	r := csv.NewReader(strings.NewReader(line))
+	r.Comma = csvDelimiter(line)
+
+	header, err := r.Read()
+	if err != nil || len(header) < 2 {
+		return false
+	}
+
+	_, ok := findCSVColumns(header)
+	return ok
+}
+
+// parseCSV finds the geo data in a CSV document with a header row. Each row with a valid
+// latitude and longitude, or a WKT geometry, becomes a Feature, with the other columns kept as
+// properties. A distance column is used as the radius of a point. The path of each is the index
+// of its row, not counting the header.
+func parseCSV(body []byte) ([]Geo, error) {
+	body = bytes.TrimPrefix(body, []byte("\ufeff"))
+	r := csv.NewReader(bytes.NewReader(body))
+	r.Comma = csvDelimiter(csvHeaderLine(body))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	cols, ok := findCSVColumns(header)
+	if !ok {
+		return nil, errNoCSVGeo
+	}
+
+	geos := make([]Geo, 0)
+	for i := 0; ; i++ {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if g := cols.geo(header, row); g != nil {
+			g.Path = []interface{}{i}
+			geos = append(geos, *g)
+		}
+	}
+	return geos, nil
+}
+
+// geo creates a Feature from a row, or returns nil if the row has no valid geo data in it.
+func (c csvColumns) geo(header, row []string) *Geo {
+	field := func(i int) string {
+		if i < 0 || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	// the columns used to make the geometry aren't kept as properties
+	used := make(map[int]bool)
+
+	var geometry map[string]interface{}
+	lat, latErr := strconv.ParseFloat(field(c.lat), 64)
+	lng, lngErr := strconv.ParseFloat(field(c.lng), 64)
+	if latErr == nil && lngErr == nil && latIsValid(lat) && lngIsValid(lng) {
+		geometry = newGeometry("Point", newPosition(lng, lat))
+		used[c.lat], used[c.lng] = true, true
+	} else if wkt, err := parseWKT(field(c.wkt)); err == nil {
+		geometry = wkt
+		used[c.wkt] = true
+	} else {
+		return nil
+	}
+
+	g := &Geo{}
+	if geometry["type"] == "Point" {
+		if dst, err := strconv.ParseFloat(field(c.dst), 64); err == nil {
+			g.Radius = dst
+		}
+	}
+
+	props := make(map[string]interface{})
+	for i, v := range row {
+		if used[i] {
+			continue
+		}
+
+		name := fmt.Sprintf("column%d", i+1)
+		if i < len(header) && strings.TrimSpace(header[i]) != "" {
+			name = strings.TrimSpace(header[i])
+		}
+		props[name] = v
+	}
+
+	g.Geo = newFeature(geometry, props)
+	return g
+}
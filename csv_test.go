@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestParseCSV(t *testing.T) {
+	body := []byte("\ufeffName,Latitude,Longitude,Accuracy,wkt\r\n" +
+		"Esri PDX,45.52,-122.68,8,\r\n" +
+		"\"Somewhere, else\",,,,\"LINESTRING (0 0, 1 1)\"\r\n" +
+		"Nowhere,95,0,,\r\n" +
+		"Short,1,2\r\n")
+
+	geos, err := parseCSV(body)
+	assert.Equal(t, nil, err)
+
+	testSlicesContainSameGeos(t, []Geo{
+		Geo{
+			Geo: newFeature(newGeometry("Point", newPosition(-122.68, 45.52)), map[string]interface{}{
+				"Name":     "Esri PDX",
+				"Accuracy": "8",
+				"wkt":      "",
+			}),
+			Radius: 8,
+			Path:   []interface{}{0},
+		},
+		Geo{
+			Geo: newFeature(newGeometry("LineString", []interface{}{newPosition(0, 0), newPosition(1, 1)}), map[string]interface{}{
+				"Name":      "Somewhere, else",
+				"Latitude":  "",
+				"Longitude": "",
+				"Accuracy":  "",
+			}),
+			Path: []interface{}{1},
+		},
+		Geo{
+			Geo: newFeature(newGeometry("Point", newPosition(2, 1)), map[string]interface{}{
+				"Name": "Short",
+			}),
+			Path: []interface{}{3},
+		},
+	}, geos)
+
+	_, err = parseCSV([]byte("name,value\nfoo,1\n"))
+	assert.Equal(t, errNoCSVGeo, err)
+}
+
+func TestCSVRequest(t *testing.T) {
+	// sniffed from the header, with semicolons for delimiters
+	gr := NewGeobinRequest(0, nil, []byte("id;lat;lng\n1;45.52;-122.68\n2;45.53;-122.69\n"))
+	assert.Equal(t, 2, len(gr.Geo))
+
+	// tabs, found from the content type
+	gr = NewGeobinRequest(0, map[string]string{"Content-Type": "text/csv"}, []byte("y\tx\n45.52\t-122.68\n"))
+	assert.Equal(t, 1, len(gr.Geo))
+
+	for _, body := range []string{
+		"latitude\n45.52\n",
+		"hello, world\n",
+		"lat,lng is what we want\n",
+	} {
+		assert.Equal(t, false, sniffCSV([]byte(body)), body)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+// esriGeos looks for Esri JSON in the given json map, which may be a geometry, a feature with a
+// geometry and attributes, or a FeatureSet like the ones feature services respond with. Each
+// geometry is converted to GeoJSON, and to WGS84 from its spatial reference when we know how.
+// Features become GeoJSON Features with their attributes as properties, and the path of each
+// feature in a FeatureSet ends with "features" and its index. It returns false if the map isn't
+// Esri JSON.
+func esriGeos(o map[string]interface{}, kp []interface{}) ([]Geo, bool) {
+	wkid := esriWKID(o, 0)
+
+	if features, ok := o["features"].([]interface{}); ok && (o["geometryType"] != nil || o["spatialReference"] != nil) {
+		geos := make([]Geo, 0)
+		for i, f := range features {
+			m, ok := f.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			if g, ok := esriFeature(m, wkid, appendPath(kp, "features", i)); ok {
+				geos = append(geos, *g)
+			}
+		}
+		return geos, true
+	}
+
+	if _, ok := o["geometry"].(map[string]interface{}); ok {
+		if g, ok := esriFeature(o, wkid, kp); ok {
+			return []Geo{*g}, true
+		}
+		return nil, false
+	}
+
+	// a point needs a spatial reference to tell it apart from the x and y keys that
+	// isOtherGeo looks for
+	if _, ok := o["x"]; ok && o["spatialReference"] == nil {
+		return nil, false
+	}
+
+	geometry, ok := esriGeometry(o)
+	if !ok {
+		return nil, false
+	}
+
+	g := Geo{
+		Path: kp,
+		Geo:  geometry,
+	}
+	if err := g.project(geometry, wkid); err != nil {
+		debugLog("Invalid Esri geometry coordinates:", err)
+		return nil, false
+	}
+
+	debugLog("Found Esri geometry:", geometry)
+	return []Geo{g}, true
+}
+
+// esriFeature converts an Esri feature to a GeoJSON Feature. The spatial reference of its
+// geometry is wkid, unless the geometry has one of its own.
+func esriFeature(f map[string]interface{}, wkid int, kp []interface{}) (*Geo, bool) {
+	m, ok := f["geometry"].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	geometry, ok := esriGeometry(m)
+	if !ok {
+		return nil, false
+	}
+
+	g := &Geo{Path: kp}
+	if err := g.project(geometry, esriWKID(m, wkid)); err != nil {
+		debugLog("Invalid Esri feature coordinates:", err)
+		return nil, false
+	}
+
+	props, _ := f["attributes"].(map[string]interface{})
+	g.Geo = newFeature(geometry, props)
+	return g, true
+}
+
+// esriWKID returns the well-known ID of the spatial reference in the given json map, preferring
+// its latestWkid, or def if it doesn't have one.
+func esriWKID(o map[string]interface{}, def int) int {
+	sr, ok := o["spatialReference"].(map[string]interface{})
+	if !ok {
+		return def
+	}
+
+	if wkid, ok := sr["latestWkid"].(float64); ok {
+		return int(wkid)
+	}
+	if wkid, ok := sr["wkid"].(float64); ok {
+		return int(wkid)
+	}
+	return def
+}
+
+// esriGeometry converts an Esri point, multipoint, polyline, polygon or envelope to a GeoJSON
+// geometry, without changing its coordinates. Z values are kept and M values are dropped.
+func esriGeometry(o map[string]interface{}) (map[string]interface{}, bool) {
+	hasZ, _ := o["hasZ"].(bool)
+	hasM, _ := o["hasM"].(bool)
+
+	if x, ok := o["x"].(float64); ok {
+		y, ok := o["y"].(float64)
+		if !ok {
+			return nil, false
+		}
+
+		pos := newPosition(x, y)
+		if z, ok := o["z"].(float64); ok {
+			pos = append(pos, z)
+		}
+		return newGeometry("Point", pos), true
+	}
+
+	if points, ok := o["points"]; ok {
+		coords, ok := esriPositions(points, hasZ, hasM)
+		if !ok || len(coords) == 0 {
+			return nil, false
+		}
+		return newGeometry("MultiPoint", coords), true
+	}
+
+	if paths, ok := o["paths"]; ok {
+		lines, ok := esriPaths(paths, hasZ, hasM)
+		if !ok || len(lines) == 0 {
+			return nil, false
+		}
+
+		if len(lines) == 1 {
+			return newGeometry("LineString", lines[0]), true
+		}
+		return newGeometry("MultiLineString", lines), true
+	}
+
+	if rings, ok := o["rings"]; ok {
+		rs, ok := esriPaths(rings, hasZ, hasM)
+		if !ok || len(rs) == 0 {
+			return nil, false
+		}
+
+		polygons := esriPolygons(rs)
+		if len(polygons) == 1 {
+			return newGeometry("Polygon", polygons[0]), true
+		}
+		return newGeometry("MultiPolygon", polygons), true
+	}
+
+	xmin, xminOK := o["xmin"].(float64)
+	ymin, yminOK := o["ymin"].(float64)
+	xmax, xmaxOK := o["xmax"].(float64)
+	ymax, ymaxOK := o["ymax"].(float64)
+	if xminOK && yminOK && xmaxOK && ymaxOK {
+		return newGeometry("Polygon", []interface{}{[]interface{}{
+			newPosition(xmin, ymin),
+			newPosition(xmax, ymin),
+			newPosition(xmax, ymax),
+			newPosition(xmin, ymax),
+			newPosition(xmin, ymin),
+		}}), true
+	}
+
+	return nil, false
+}
+
+// esriPaths converts the paths of a polyline or the rings of a polygon to GeoJSON.
+func esriPaths(v interface{}, hasZ, hasM bool) ([]interface{}, bool) {
+	a, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	paths := make([]interface{}, len(a))
+	for i, p := range a {
+		if paths[i], ok = esriPositions(p, hasZ, hasM); !ok {
+			return nil, false
+		}
+	}
+	return paths, true
+}
+
+// esriPositions converts an array of Esri positions, [x, y], [x, y, z], [x, y, m] or
+// [x, y, z, m], to GeoJSON positions.
+func esriPositions(v interface{}, hasZ, hasM bool) ([]interface{}, bool) {
+	a, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	positions := make([]interface{}, len(a))
+	for i, p := range a {
+		vals, ok := p.([]interface{})
+		if !ok || len(vals) < 2 || len(vals) > 4 {
+			return nil, false
+		}
+		for _, v := range vals {
+			if _, ok := v.(float64); !ok {
+				return nil, false
+			}
+		}
+
+		// a third value is z, unless the geometry says it only has m values
+		n := 2
+		if len(vals) == 4 || (len(vals) == 3 && (hasZ || !hasM)) {
+			n = 3
+		}
+
+		pos := make([]interface{}, n)
+		copy(pos, vals)
+		positions[i] = pos
+	}
+	return positions, true
+}
+
+// esriPolygons sorts the rings of an Esri polygon into GeoJSON polygons. Esri outer rings go
+// clockwise and holes go counterclockwise, so each hole is put with the outer ring it is inside.
+// A hole that isn't inside an outer ring is taken to be an outer ring itself. GeoJSON winds its
+// rings the other way, so every ring is reversed.
+func esriPolygons(rings []interface{}) []interface{} {
+	outers := make([][]interface{}, 0)
+	holes := make([][]interface{}, 0)
+	for _, r := range rings {
+		ring := r.([]interface{})
+		if ringArea(ring) > 0 {
+			holes = append(holes, ring)
+		} else {
+			outers = append(outers, ring)
+		}
+	}
+
+	polygons := make([][]interface{}, len(outers))
+	for i, outer := range outers {
+		polygons[i] = []interface{}{reverseRing(outer)}
+	}
+
+Holes:
+	for _, hole := range holes {
+		if len(hole) > 0 {
+			for i, outer := range outers {
+				if ringContains(outer, hole[0].([]interface{})) {
+					polygons[i] = append(polygons[i], reverseRing(hole))
+					continue Holes
+				}
+			}
+		}
+		polygons = append(polygons, []interface{}{reverseRing(hole)})
+	}
+
+	ps := make([]interface{}, len(polygons))
+	for i, p := range polygons {
+		ps[i] = p
+	}
+	return ps
+}
+
+// ringArea returns twice the signed area of a ring, which is positive if the ring goes
+// counterclockwise and negative if it goes clockwise.
+func ringArea(ring []interface{}) float64 {
+	var area float64
+	for i := range ring {
+		a := ring[i].([]interface{})
+		b := ring[(i+1)%len(ring)].([]interface{})
+		area += a[0].(float64)*b[1].(float64) - b[0].(float64)*a[1].(float64)
+	}
+	return area
+}
+
+// ringContains reports whether the position is inside the ring.
+func ringContains(ring []interface{}, pos []interface{}) bool {
+	x, y := pos[0].(float64), pos[1].(float64)
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a := ring[i].([]interface{})
+		b := ring[j].([]interface{})
+		ax, ay := a[0].(float64), a[1].(float64)
+		bx, by := b[0].(float64), b[1].(float64)
+		if (ay > y) != (by > y) && x < (bx-ax)*(y-ay)/(by-ay)+ax {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// reverseRing returns a copy of the ring going the other way.
+func reverseRing(ring []interface{}) []interface{} {
+	r := make([]interface{}, len(ring))
+	for i, pos := range ring {
+		r[len(ring)-1-i] = pos
+	}
+	return r
+}
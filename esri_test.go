@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestEsriGeometry(t *testing.T) {
+	tests := []struct {
+		esri, geojson string
+	}{
+		{`{"x": 1, "y": 2, "z": 3}`, `{"type":"Point","coordinates":[1,2,3]}`},
+		{`{"points": [[1, 2], [3, 4]]}`, `{"type":"MultiPoint","coordinates":[[1,2],[3,4]]}`},
+		{`{"hasM": true, "paths": [[[1, 2, 9], [3, 4, 9]]]}`, `{"type":"LineString","coordinates":[[1,2],[3,4]]}`},
+		{`{"hasZ": true, "paths": [[[1, 2, 5], [3, 4, 6]], [[5, 6, 7], [7, 8, 8]]]}`, `{"type":"MultiLineString","coordinates":[[[1,2,5],[3,4,6]],[[5,6,7],[7,8,8]]]}`},
+		{`{"xmin": 1, "ymin": 2, "xmax": 3, "ymax": 4}`, `{"type":"Polygon","coordinates":[[[1,2],[3,2],[3,4],[1,4],[1,2]]]}`},
+		// a clockwise outer ring and its counterclockwise hole
+		{
+			`{"rings": [[[0, 0], [0, 10], [10, 10], [10, 0], [0, 0]], [[1, 1], [2, 1], [2, 2], [1, 1]]]}`,
+			`{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10],[0,0]],[[1,1],[2,2],[2,1],[1,1]]]}`,
+		},
+		// two outer rings
+		{
+			`{"rings": [[[0, 0], [0, 1], [1, 1], [0, 0]], [[5, 5], [5, 6], [6, 6], [5, 5]]]}`,
+			`{"type":"MultiPolygon","coordinates":[[[[0,0],[1,1],[0,1],[0,0]]],[[[5,5],[6,6],[5,6],[5,5]]]]}`,
+		},
+	}
+
+	for _, test := range tests {
+		var o, exp map[string]interface{}
+		if err := json.Unmarshal([]byte(test.esri), &o); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(test.geojson), &exp); err != nil {
+			t.Fatal(err)
+		}
+
+		got, ok := esriGeometry(o)
+		assert.Equal(t, true, ok, test.esri)
+		assert.Equal(t, exp, got, test.esri)
+	}
+
+	for _, s := range []string{
+		`{"points": ["a", "b"]}`,
+		`{"paths": [[1, 2]]}`,
+		`{"rings": []}`,
+		`{"xmin": 1, "ymin": 2}`,
+		`{"x": 1}`,
+	} {
+		var o map[string]interface{}
+		if err := json.Unmarshal([]byte(s), &o); err != nil {
+			t.Fatal(err)
+		}
+
+		_, ok := esriGeometry(o)
+		assert.Equal(t, false, ok, s)
+	}
+}
+
+func TestEsriRequest(t *testing.T) {
+	gr := NewGeobinRequest(0, nil, []byte(`{
+		"mercator": {"x": -13627361, "y": 5705271, "spatialReference": {"wkid": 102100, "latestWkid": 3857}},
+		"wgs84": {"x": -122.68, "y": 45.52, "spatialReference": {"wkid": 4326}},
+		"other": {"x": 530000, "y": 180000},
+		"featureSet": {
+			"geometryType": "esriGeometryPoint",
+			"spatialReference": {"wkid": 102100},
+			"features": [
+				{"attributes": {"name": "Esri PDX"}, "geometry": {"x": -13627361, "y": 5705271}},
+				{"attributes": {"name": "Nowhere"}},
+				{"geometry": {"x": -122.68, "y": 45.52, "spatialReference": {"wkid": 4326}}}
+			]
+		}
+	}`))
+
+	testSlicesContainSameItems(t, []interface{}{
+		[]interface{}{"mercator"},
+		[]interface{}{"wgs84"},
+		[]interface{}{"featureSet", "features", 0},
+		[]interface{}{"featureSet", "features", 2},
+	}, func() []interface{} {
+		paths := make([]interface{}, len(gr.Geo))
+		for i, g := range gr.Geo {
+			paths[i] = g.Path
+		}
+		return paths
+	}())
+
+	for _, g := range gr.Geo {
+		switch g.Path[0] {
+		case "mercator":
+			assert.Equal(t, "EPSG:3857", g.CRS)
+			coords := g.Geo["coordinates"].([]interface{})
+			assert.T(t, math.Abs(coords[0].(float64)+122.4167) < 0.001, coords)
+		case "wgs84":
+			assert.Equal(t, "", g.CRS)
+		case "featureSet":
+			if g.Path[2] == 0 {
+				assert.Equal(t, "ESRI:102100", g.CRS)
+				assert.Equal(t, map[string]interface{}{"name": "Esri PDX"}, g.Geo["properties"])
+			} else {
+				assert.Equal(t, "", g.CRS)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+)
+
+// Events are sent to the websockets watching a bin to tell them about something that
+// happened to the bin itself, rather than a request that was posted to it. They are
+// JSON objects with an "event" key naming the event, which is how clients tell them
+// apart from requests.
+const (
+	// the connection to the pubsub server was lost and has been restored. The "missed"
+	// key holds the number of requests that may have been posted in the meantime.
+	eventReconnected = "reconnected"
+
+	// the bin's expiration time has changed. The "expires" key holds the new expiration
+	// timestamp, in Unix time.
+	eventExpiry = "expiry"
+
+	// the bin has been deleted. This is the last message the sockets for a bin will be
+	// sent before they are closed.
+	eventDeleted = "deleted"
+
+	// the bin will expire soon. The "expires" key holds its expiration timestamp, in
+	// Unix time.
+	eventExpiring = "expiring"
+
+	// the bin has expired. Like a deleted event, this is the last message the sockets for
+	// a bin will be sent before they are closed.
+	eventExpired = "expired"
+
+	// the oldest requests in the bin were dropped to keep it within its retention limits.
+	// The "dropped" key holds the number of requests that were dropped.
+	eventDropped = "dropped"
+)
+
+var (
+	// deletedEvent is what's published when a bin is deleted.
+	deletedEvent = encodeEvent(eventDeleted, nil)
+	// expiredEvent is what's sent to a bin's sockets once the bin has expired.
+	expiredEvent = encodeEvent(eventExpired, nil)
+)
+
+// encodeEvent returns the JSON for the named event with the given data added to it.
+func encodeEvent(event string, data map[string]interface{}) []byte {
+	msg := map[string]interface{}{
+		"event": event,
+	}
+	for k, v := range data {
+		msg[k] = v
+	}
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		// the data we put in events is always encodable, so this is a programming error
+		log.Println("Error encoding", event, "event:", err)
+	}
+	return b
+}
+
+// deliver sends a payload published to a bin on to the bin's sockets. If the payload
+// is a deleted event, the sockets are closed after they've been sent it.
+func deliver(sm SocketMap, binName string, payload []byte) error {
+	if bytes.Equal(payload, deletedEvent) {
+		return sm.CloseBin(binName, payload)
+	}
+	return sm.Send(binName, payload)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// how often the expiry watcher checks on the bins that have sockets open
+const expiryWatchInterval = 5 * time.Second
+
+// expiryWatcher keeps an eye on the bins that have sockets open. It warns the sockets
+// when their bin is about to expire, and closes them once it has.
+//
+// Redis tells us about expired bins as soon as they happen through keyspace
+// notifications (see redisPump), so for the redis store this mostly sends warnings and
+// catches any expirations that were missed, such as when notifications can't be
+// turned on. The other stores have no such thing, so this is how their sockets find out.
+type expiryWatcher struct {
+	st Store
+	sm SocketMap
+	// how long before a bin expires its sockets are warned, or zero for no warnings
+	warning time.Duration
+	// the expiration time each bin's sockets were last warned about
+	warned map[string]time.Time
+}
+
+func newExpiryWatcher(st Store, sm SocketMap, warning time.Duration) *expiryWatcher {
+	return &expiryWatcher{
+		st:      st,
+		sm:      sm,
+		warning: warning,
+		warned:  make(map[string]time.Time),
+	}
+}
+
+// run checks on the watched bins every interval, forever.
+func (ew *expiryWatcher) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		ew.check(now, interval)
+	}
+}
+
+// check sends an expired event to the sockets of every bin that has expired, and an
+// expiring event to those of every bin that will expire within the warning time. A
+// bin's sockets are only warned once per expiration time, so warnings will be sent
+// again if the bin is given longer to live. Bins whose expiration times moved by less
+// than slop since the last warning are taken to be unchanged.
+func (ew *expiryWatcher) check(now time.Time, slop time.Duration) {
+	watched := make(map[string]bool)
+	for _, binName := range ew.sm.Bins() {
+		watched[binName] = true
+
+		ttl, err := ew.st.TTL(binName)
+		if err == errBinNotFound {
+			debugLog("Closing sockets for expired bin", binName)
+			delete(ew.warned, binName)
+			if err = ew.sm.CloseBin(binName, expiredEvent); err != nil {
+				log.Println(err)
+			}
+			continue
+		} else if err != nil {
+			log.Println("Failure to get TTL for", binName, err)
+			continue
+		}
+
+		// bins that never expire have no expiration time to warn about
+		if ew.warning <= 0 || ttl <= 0 || ttl > ew.warning {
+			delete(ew.warned, binName)
+			continue
+		}
+
+		expires := now.Add(ttl)
+		if last, ok := ew.warned[binName]; ok && expires.Sub(last) < slop {
+			continue
+		}
+
+		ew.warned[binName] = expires
+		if err = ew.sm.Send(binName, encodeEvent(eventExpiring, map[string]interface{}{
+			"expires": expires.Unix(),
+		})); err != nil {
+			log.Println(err)
+		}
+	}
+
+	// forget about bins that nobody is watching any more
+	for binName := range ew.warned {
+		if !watched[binName] {
+			delete(ew.warned, binName)
+		}
+	}
+}
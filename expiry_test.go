@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+	"github.com/go-redis/redis"
+)
+
+func TestExpiryWatcher(t *testing.T) {
+	testExpiryWatcher(t, NewMemoryStore())
+}
+
+func TestExpiryWatcherRedis(t *testing.T) {
+	testExpiryWatcher(t, NewRedisStore(NewMockRedis()))
+}
+
+// testExpiryWatcher checks that the sockets of expiring and expired bins in st are told so.
+func testExpiryWatcher(t *testing.T, st Store) {
+	sm := NewSocketMap(nil)
+	ew := newExpiryWatcher(st, sm, 5*time.Minute)
+
+	sockets := make(map[string]*MockSocket)
+	for _, binName := range []string{"long_lived", "expiring", "expired"} {
+		assert.Equal(t, nil, st.CreateBin(binName, time.Hour))
+		sockets[binName] = &MockSocket{name: binName}
+		sm.Add(binName, "socket_uuid", sockets[binName])
+	}
+	assert.Equal(t, nil, st.Expire("expiring", time.Minute))
+	assert.Equal(t, nil, st.Expire("expired", -time.Second))
+
+	ew.check(time.Now(), expiryWatchInterval)
+	time.Sleep(25 * time.Millisecond)
+
+	// a real socket would delete itself once closed. After that, a second check shouldn't
+	// warn about the same expiration time again.
+	assert.Equal(t, nil, sm.Delete("expired", "socket_uuid"))
+	ew.check(time.Now(), expiryWatchInterval)
+	time.Sleep(25 * time.Millisecond)
+
+	assert.Equal(t, false, sockets["long_lived"].getDidWrite())
+
+	assert.Equal(t, []string{`{"event":"expired"}`}, sockets["expired"].getPayloads())
+	assert.Equal(t, true, sockets["expired"].getClosed())
+
+	payloads := sockets["expiring"].getPayloads()
+	assert.Equal(t, 1, len(payloads))
+	assertExpiringEvent(t, payloads[0], time.Minute)
+	assert.Equal(t, false, sockets["expiring"].getClosed())
+
+	// but if the bin is given longer to live, it's worth another warning
+	assert.Equal(t, nil, st.Expire("expiring", 3*time.Minute))
+	ew.check(time.Now(), expiryWatchInterval)
+	time.Sleep(25 * time.Millisecond)
+
+	payloads = sockets["expiring"].getPayloads()
+	assert.Equal(t, 2, len(payloads))
+	assertExpiringEvent(t, payloads[1], 3*time.Minute)
+}
+
+func TestExpiryWatcherNoWarning(t *testing.T) {
+	ms := NewMemoryStore()
+	sm := NewSocketMap(getUnsubFunc(t))
+	ew := newExpiryWatcher(ms, sm, 0)
+
+	mock := &MockSocket{name: "mock_socket"}
+	assert.Equal(t, nil, ms.CreateBin("bin_name", time.Second))
+	sm.Add("bin_name", "socket_uuid", mock)
+
+	ew.check(time.Now(), expiryWatchInterval)
+	time.Sleep(25 * time.Millisecond)
+	assert.Equal(t, false, mock.getDidWrite())
+}
+
+func TestExpiryWatcherNoExpiry(t *testing.T) {
+	mr := NewMockRedis()
+	sm := NewSocketMap(getUnsubFunc(t))
+	ew := newExpiryWatcher(NewRedisStore(mr), sm, 5*time.Minute)
+
+	// a bin that has lost its expiration shouldn't be warned about or closed
+	_, err := mr.ZAdd("persisted", redis.Z{Score: 0, Member: ""})
+	assert.Equal(t, nil, err)
+	mock := &MockSocket{name: "mock_socket"}
+	sm.Add("persisted", "socket_uuid", mock)
+
+	ew.check(time.Now(), expiryWatchInterval)
+	time.Sleep(25 * time.Millisecond)
+	assert.Equal(t, false, mock.getDidWrite())
+	assert.Equal(t, false, mock.getClosed())
+}
+
+func assertExpiringEvent(t *testing.T, payload string, ttl time.Duration) {
+	var event struct {
+		Event   string `json:"event"`
+		Expires int64  `json:"expires"`
+	}
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, eventExpiring, event.Event)
+	expected := time.Now().Add(ttl).Unix()
+	if event.Expires < expected-2 || event.Expires > expected+2 {
+		t.Errorf("Expected expiration near %d, got %d", expected, event.Expires)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"mime"
+	"strings"
+)
+
+// bodyFormat is a format other than JSON that geo data can be sent to a bin in.
+type bodyFormat struct {
+	name string
+	// the media types that mark a body as being in this format
+	contentTypes []string
+	// sniff reports whether a body looks like it's in this format, for when its content type
+	// doesn't say so
+	sniff func(body []byte) bool
+	// parse finds the geo data in a body
+	parse func(body []byte) ([]Geo, error)
+}
+
+// bodyFormats are the formats that request bodies which aren't JSON are tried as, in order.
+var bodyFormats = []*bodyFormat{
+	{
+		name:         "GPX",
+		contentTypes: []string{"application/gpx+xml", "application/gpx"},
+		sniff:        sniffGPX,
+		parse:        parseGPX,
+	},
+	{
+		name:         "KML",
+		contentTypes: []string{"application/vnd.google-earth.kml+xml"},
+		sniff:        sniffKML,
+		parse:        parseKML,
+	},
+	{
+		name:         "KMZ",
+		contentTypes: []string{"application/vnd.google-earth.kmz"},
+		sniff:        sniffKMZ,
+		parse:        parseKMZ,
+	},
+	{
+		name:         "CSV",
+		contentTypes: []string{"text/csv", "application/csv", "text/comma-separated-values"},
+		sniff:        sniffCSV,
+		parse:        parseCSV,
+	},
+	{
+		name:         "NMEA",
+		contentTypes: []string{"application/nmea", "text/x-nmea"},
+		sniff:        sniffNMEA,
+		parse:        parseNMEA,
+	},
+}
+
+// matches reports whether a body with the given media type might be in this format.
+func (f *bodyFormat) matches(mediaType string, body []byte) bool {
+	for _, ct := range f.contentTypes {
+		if ct == mediaType {
+			return true
+		}
+	}
+	return f.sniff != nil && f.sniff(body)
+}
+
+// mediaType returns the media type from the Content-Type in the given request headers,
+// lower cased and without any parameters, or "" if there isn't one.
+func mediaType(headers map[string]string) string {
+	for k, v := range headers {
+		if strings.ToLower(k) != "content-type" {
+			continue
+		}
+
+		mt, _, err := mime.ParseMediaType(v)
+		if err != nil {
+			return ""
+		}
+		return mt
+	}
+	return ""
+}
+
+// sniffXML reports whether body looks like an XML document with the given root element
+// somewhere near its start.
+func sniffXML(body []byte, root string) bool {
+	if len(body) > 1024 {
+		body = body[:1024]
+	}
+
+	s := strings.TrimLeft(string(body), " \t\r\n\ufeff")
+	return strings.HasPrefix(s, "<") && strings.Contains(s, "<"+root)
+}
+
+// newFeature creates a GeoJSON Feature with the given geometry and properties, which are
+// left out if there aren't any.
+func newFeature(geometry map[string]interface{}, properties map[string]interface{}) map[string]interface{} {
+	f := map[string]interface{}{
+		"type":     "Feature",
+		"geometry": geometry,
+	}
+	if len(properties) > 0 {
+		f["properties"] = properties
+	}
+	return f
+}
+
+// newGeometry creates a GeoJSON geometry of the given type.
+func newGeometry(t string, coords interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        t,
+		"coordinates": coords,
+	}
+}
+
+// newPosition creates a GeoJSON position.
+func newPosition(lng, lat float64) []interface{} {
+	return []interface{}{lng, lat}
+}
+
+// appendPath returns a copy of kp with the given keys added to the end, so that the paths
+// of sibling geos never share a backing array.
+func appendPath(kp []interface{}, keys ...interface{}) []interface{} {
+	p := make([]interface{}, 0, len(kp)+len(keys))
+	p = append(p, kp...)
+	return append(p, keys...)
+}
+
+// lastKey returns the last object key in a path, skipping over any array indexes after it, or ""
+// if there isn't one.
+func lastKey(kp []interface{}) string {
+	for i := len(kp) - 1; i >= 0; i-- {
+		if k, ok := kp[i].(string); ok {
+			return k
+		}
+	}
+	return ""
+}
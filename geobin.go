@@ -8,13 +8,21 @@ import (
 	"log"
 	"net/http"
 	"runtime"
+	"time"
 
 	"github.com/go-redis/redis"
 )
 
+const (
+	// How long to wait before the first and longest retries when reconnecting to redis
+	redisReconnectMinWait = time.Second
+	redisReconnectMaxWait = 30 * time.Second
+)
+
 // some read-only global vars
 var isDebug = flag.Bool("debug", false, "Boolean flag indicates a debug build. Affects log statements.")
 var isVerbose = flag.Bool("verbose", false, "Boolean flag indicates you want to see a lot of log messages.")
+var doMigrate = flag.Bool("migrate", false, "Boolean flag indicates you want to copy all bins from redis into the configured Store and exit.")
 
 func init() {
 	// add file info to log statements
@@ -29,62 +37,166 @@ func main() {
 
 	// load up config.json
 	conf := loadConfig()
+	setPolylineKeys(conf.PolylineKeys)
 
-	// redis client
-	client := redis.NewTCPClient(&redis.Options{
-		Addr:     conf.RedisHost,
-		Password: conf.RedisPass,
-		DB:       conf.RedisDB,
-	})
-
-	if ping := client.Ping(); ping.Err() != nil {
-		log.Fatal(ping.Err())
+	if *doMigrate {
+		runMigration(conf)
+		return
 	}
 
-	// redis pubsub connection
-	ps := client.PubSub()
+	// storage and pubsub
+	be, err := newBackend(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer be.close()
 
 	// prepare a socketmap
-	sm := NewSocketMap(ps)
+	sm := NewSocketMap(be.PubSubber)
 
-	// loop for receiving messages from Redis pubsub, and forwarding them on to relevant ws connection
-	go redisPump(ps, sm)
+	// loop for receiving published messages, and forwarding them on to relevant ws connection
+	go be.pump(sm)
 
-	defer func() {
-		ps.Close()
-		client.Close()
-	}()
+	// warn sockets about their bins expiring, and close them when they do
+	go newExpiryWatcher(be.Store, sm, time.Duration(conf.ExpiryWarning)*time.Second).run(expiryWatchInterval)
 
 	// prepare server
-	http.Handle("/", NewGeobinServer(conf, NewRedisWrapper(client), ps, sm))
+	http.Handle("/", NewGeobinServer(conf, be.Store, be.PubSubber, sm))
 
 	// Start up HTTP server
-	log.Println("Starting server at", conf.Host, conf.Port)
-	err := http.ListenAndServe(fmt.Sprintf("%v:%d", conf.Host, conf.Port), nil)
+	log.Println("Starting server at", conf.Host, conf.Port, "using", conf.Store, "store")
+	err = http.ListenAndServe(fmt.Sprintf("%v:%d", conf.Host, conf.Port), nil)
 	if err != nil {
 		log.Fatal("ListenAndServe: ", err)
 	}
 }
 
+// redisReceiver is the part of redisPubSub used by redisPump, split out for testing purposes
+type redisReceiver interface {
+	Receive() (interface{}, error)
+	Subscribe(channels ...string) error
+	reconnect(channels []string) error
+}
+
 // redisPump reads messages out of redis and pushes them through the
-// appropriate websocket
-func redisPump(ps *redis.PubSub, sm SocketMap) {
+// appropriate websocket. Messages on expiredChannel are keyspace notifications
+// naming a key that has expired, and if that key is a bin with sockets open, the
+// sockets are sent an expired event and closed. If the connection to redis is lost,
+// it reconnects and resubscribes to every bin that still has sockets open, then lets
+// those sockets know how many requests they may have missed (as counted by countSince).
+func redisPump(rr redisReceiver, expiredChannel string, countSince func(binName string, ts int64) (int64, error), sm SocketMap) {
+	// when we last heard from redis. The connection may have dropped any time after this,
+	// so any requests since then may have been missed.
+	lost := time.Now().Unix()
 	for {
-		v, err := ps.Receive()
+		v, err := rr.Receive()
 		if err != nil {
 			log.Println("Error from Redis PubSub:", err)
-			return
+
+			bins, err := redisReconnect(rr, expiredChannel, sm)
+			if err != nil {
+				log.Println("Stopping Redis PubSub pump:", err)
+				return
+			}
+
+			for _, binName := range bins {
+				missed, err := countSince(binName, lost)
+				if err != nil {
+					log.Println("Failure to count missed requests for", binName, err)
+				}
+
+				if err = sm.Send(binName, encodeEvent(eventReconnected, map[string]interface{}{
+					"missed": missed,
+				})); err != nil {
+					log.Println(err)
+				}
+			}
+			lost = time.Now().Unix()
+			continue
 		}
+		lost = time.Now().Unix()
 
 		switch v := v.(type) {
 		case *redis.Message:
-			if err = sm.Send(v.Channel, []byte(v.Payload)); err != nil {
+			if v.Channel == expiredChannel {
+				// most expired keys won't have any sockets open, so this is only worth a mention
+				if err = sm.CloseBin(v.Payload, expiredEvent); err != nil {
+					verboseLog(err)
+				}
+				continue
+			}
+
+			if err = deliver(sm, v.Channel, []byte(v.Payload)); err != nil {
 				log.Println(err)
 			}
 		}
 	}
 }
 
+// redisReconnect tries to reconnect to redis until it succeeds, backing off between
+// attempts. It returns the bins that were resubscribed to, or an error if the pubsub
+// connection was closed on purpose. The expiredChannel is resubscribed to as well,
+// unless it is empty. Sockets opened while reconnecting subscribed on the old
+// connection, so their bins are subscribed to again once the new one is up.
+func redisReconnect(rr redisReceiver, expiredChannel string, sm SocketMap) ([]string, error) {
+	wait := redisReconnectMinWait
+	for {
+		bins := sm.Bins()
+		channels := bins
+		if expiredChannel != "" {
+			channels = append([]string{expiredChannel}, bins...)
+		}
+
+		err := rr.reconnect(channels)
+		if err == nil {
+			log.Println("Reconnected to Redis PubSub, resubscribed to", len(bins), "bins")
+			redisSubscribeNew(rr, bins, sm)
+			return bins, nil
+		}
+
+		if err == errPubSubClosed {
+			return nil, err
+		}
+
+		log.Println("Failure to reconnect to Redis PubSub, trying again in", wait, err)
+		time.Sleep(wait)
+		if wait *= 2; wait > redisReconnectMaxWait {
+			wait = redisReconnectMaxWait
+		}
+	}
+}
+
+// redisSubscribeNew subscribes to the bins with sockets open that aren't in subscribed.
+func redisSubscribeNew(rr redisReceiver, subscribed []string, sm SocketMap) {
+	had := make(map[string]bool, len(subscribed))
+	for _, binName := range subscribed {
+		had[binName] = true
+	}
+
+	opened := make([]string, 0)
+	for _, binName := range sm.Bins() {
+		if !had[binName] {
+			opened = append(opened, binName)
+		}
+	}
+
+	if len(opened) > 0 {
+		if err := rr.Subscribe(opened...); err != nil {
+			log.Println("Failure to SUBSCRIBE to", opened, err)
+		}
+	}
+}
+
+// memoryPump reads messages published to a memoryPubSub and pushes them through
+// the appropriate websocket
+func memoryPump(mps *memoryPubSub, sm SocketMap) {
+	for m := range mps.msgs {
+		if err := deliver(sm, m.channel, []byte(m.payload)); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
 // debugLog logs messages sent to it if and only if isDebug or isVerbose are set to true
 func debugLog(v ...interface{}) {
 	if *isDebug || *isVerbose {
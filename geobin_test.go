@@ -1,7 +1,147 @@
 package main
 
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+	"github.com/go-redis/redis"
+)
+
 func init() {
 	// make the default for isDebug be true when running tests. If you run `go test -debug=false`
 	// the tests will not print out the debug info.
 	// *isDebug = true
 }
+
+// fakeReceiver hands out the results it was given one at a time, and fails with
+// errPubSubClosed once it runs out of them.
+type fakeReceiver struct {
+	lk         sync.Mutex
+	results    []error
+	reconnects [][]string
+	subscribes [][]string
+	// called the first time reconnect is, before it returns
+	onReconnect func()
+	// the messages handed out for nil results, or a message for bin_name if there are none left
+	messages []*redis.Message
+}
+
+func (fr *fakeReceiver) Receive() (interface{}, error) {
+	fr.lk.Lock()
+	defer fr.lk.Unlock()
+	if len(fr.results) == 0 {
+		return nil, errPubSubClosed
+	}
+
+	err := fr.results[0]
+	fr.results = fr.results[1:]
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fr.messages) > 0 {
+		m := fr.messages[0]
+		fr.messages = fr.messages[1:]
+		return m, nil
+	}
+	return &redis.Message{Channel: "bin_name", Payload: "a message"}, nil
+}
+
+func (fr *fakeReceiver) reconnect(channels []string) error {
+	fr.lk.Lock()
+	defer fr.lk.Unlock()
+	fr.reconnects = append(fr.reconnects, channels)
+	if len(fr.results) == 0 {
+		return errPubSubClosed
+	}
+
+	if fr.onReconnect != nil {
+		fr.onReconnect()
+		fr.onReconnect = nil
+	}
+	return nil
+}
+
+func (fr *fakeReceiver) Subscribe(channels ...string) error {
+	fr.lk.Lock()
+	defer fr.lk.Unlock()
+	fr.subscribes = append(fr.subscribes, channels)
+	return nil
+}
+
+func TestRedisPumpReconnects(t *testing.T) {
+	sm := NewSocketMap(getUnsubFunc(t))
+	ms := &MockSocket{name: "mock_socket"}
+	sm.Add("bin_name", "socket_uuid", ms)
+
+	fr := &fakeReceiver{results: []error{nil, errors.New("connection lost"), nil}}
+	var countedSince int64
+	redisPump(fr, "expired_channel", func(binName string, ts int64) (int64, error) {
+		assert.Equal(t, "bin_name", binName)
+		countedSince = ts
+		return 3, nil
+	}, sm)
+
+	// it should have resubscribed to our bin and expiry notifications after losing the
+	// connection, then given up when the connection was closed
+	assert.Equal(t, [][]string{{"expired_channel", "bin_name"}, {"expired_channel", "bin_name"}}, fr.reconnects)
+	assert.NotEqual(t, int64(0), countedSince)
+
+	// SocketMap.Send writes from separate goroutines, so the order isn't guaranteed
+	time.Sleep(25 * time.Millisecond)
+	payloads := ms.getPayloads()
+	sort.Strings(payloads)
+	assert.Equal(t, []string{"a message", "a message", `{"event":"reconnected","missed":3}`}, payloads)
+}
+
+func TestRedisPumpSubscribesDuringReconnect(t *testing.T) {
+	sm := NewSocketMap(getUnsubFunc(t))
+	sm.Add("bin_name", "socket_uuid", &MockSocket{name: "mock_socket"})
+
+	// a socket opened while reconnecting subscribed on the old connection
+	fr := &fakeReceiver{results: []error{errors.New("connection lost"), nil}}
+	fr.onReconnect = func() {
+		sm.Add("new_bin", "socket_uuid", &MockSocket{name: "new_socket"})
+	}
+	before := time.Now().Unix()
+	var countedSince int64
+	redisPump(fr, "expired_channel", func(binName string, ts int64) (int64, error) {
+		countedSince = ts
+		return 0, nil
+	}, sm)
+
+	assert.Equal(t, []string{"expired_channel", "bin_name"}, fr.reconnects[0])
+	assert.Equal(t, [][]string{{"new_bin"}}, fr.subscribes)
+	// the connection was lost before the first Receive, so anything since the pump
+	// started may have been missed
+	assert.T(t, countedSince >= before && countedSince <= time.Now().Unix(), countedSince)
+}
+
+func TestRedisPumpExpired(t *testing.T) {
+	sm := NewSocketMap(getUnsubFunc(t))
+	ms := &MockSocket{name: "mock_socket"}
+	sm.Add("bin_name", "socket_uuid", ms)
+
+	fr := &fakeReceiver{
+		results: []error{nil, nil, nil},
+		messages: []*redis.Message{
+			// keys that aren't bins with sockets open should be ignored
+			{Channel: "expired_channel", Payload: "rate-limit:127.0.0.1"},
+			{Channel: "bin_name", Payload: "a message"},
+			{Channel: "expired_channel", Payload: "bin_name"},
+		},
+	}
+	redisPump(fr, "expired_channel", func(binName string, ts int64) (int64, error) {
+		return 0, nil
+	}, sm)
+
+	time.Sleep(25 * time.Millisecond)
+	payloads := ms.getPayloads()
+	sort.Strings(payloads)
+	assert.Equal(t, []string{"a message", `{"event":"expired"}`}, payloads)
+	assert.Equal(t, true, ms.getClosed())
+}
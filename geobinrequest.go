@@ -25,6 +25,17 @@ type Geo struct {
 	Geo    map[string]interface{} `json:"geo"`
 	Radius float64                `json:"radius,omitempty"`
 	Path   []interface{}          `json:"path"`
+	// the coordinate reference system the geo data was found in, if it wasn't WGS84, whether
+	// it was guessed from the coordinates rather than given, and whether we couldn't convert it
+	// to WGS84, in which case it can't be drawn on a map
+	CRS           string `json:"crs,omitempty"`
+	CRSGuessed    bool   `json:"crsGuessed,omitempty"`
+	Untransformed bool   `json:"untransformed,omitempty"`
+	// how the geo data was read from strings, such as "dms" for degrees, minutes and seconds, if
+	// it was found in strings rather than numbers
+	Interpretation string `json:"interpretation,omitempty"`
+	// the problems with GeoJSON found in the request, if it doesn't quite follow RFC 7946
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
 }
 
 // NewGeobinRequest creates a new GeobinRequest with the given timestamp,
@@ -44,11 +55,12 @@ func NewGeobinRequest(timestamp int64, headers map[string]string, body []byte) *
 	return &gr
 }
 
-// Parse parses `gr.Body` and fills `gr.Geo` with any geographic data it finds.
+// Parse parses `gr.Body` and fills `gr.Geo` with any geographic data it finds. Bodies that
+// aren't JSON are handed off to parseBody.
 func (gr *GeobinRequest) Parse() {
 	var js interface{}
 	if err := json.Unmarshal([]byte(gr.Body), &js); err != nil {
-		debugLog("No json found in request:", gr.Body)
+		gr.parseBody()
 		return
 	}
 
@@ -56,7 +68,33 @@ func (gr *GeobinRequest) Parse() {
 	gr.wg.Wait()
 }
 
-// parse curries the parsing work off to parseObject or parseArray as needed depending
+// parseBody tries each of the bodyFormats that the request's content type or body suggest,
+// and fills `gr.Geo` with the geographic data found by the first one that can parse it.
+func (gr *GeobinRequest) parseBody() {
+	body := []byte(gr.Body)
+	mt := mediaType(gr.Headers)
+	for _, f := range bodyFormats {
+		if !f.matches(mt, body) {
+			continue
+		}
+
+		geos, err := f.parse(body)
+		if err != nil {
+			debugLog("Couldn't parse request as", f.name+":", err)
+			continue
+		}
+
+		debugLog("Found", f.name, "request with", len(geos), "geos")
+		for _, g := range geos {
+			gr.appendGeo(g)
+		}
+		return
+	}
+
+	debugLog("No json or other known format found in request:", gr.Body)
+}
+
+// parse curries the parsing work off to parseObject, parseArray or parseString as needed depending
 // on the type of 'b' and signals to the WaitGroup when it has finished. This method
 // is recursive and is called from both parseObject and parseArray when necessary.
 func (gr *GeobinRequest) parse(b interface{}, kp []interface{}) {
@@ -71,6 +109,9 @@ func (gr *GeobinRequest) parse(b interface{}, kp []interface{}) {
 		case map[string]interface{}:
 			verboseLog("parsing as object")
 			gr.parseObject(t, kp)
+		case string:
+			verboseLog("parsing as string")
+			gr.parseString(t, kp)
 		default:
 			verboseLog("unknown type:", reflect.TypeOf(t))
 		}
@@ -85,7 +126,8 @@ func (gr *GeobinRequest) appendGeo(geo Geo) {
 	gr.Geo = append(gr.Geo, geo)
 }
 
-// parseObject checks to see if the given map is GeoJSON or has geo data at the top level.
+// parseObject checks to see if the given map is GeoJSON, TopoJSON, Esri JSON or has geo data, such as a
+// latitude and longitude or a UTM position, at the top level.
 // If the map has neither of those, then parseObject will iterate through the top level keys
 // sending them back up to `parse` in a new goroutine.
 func (gr *GeobinRequest) parseObject(o map[string]interface{}, kp []interface{}) {
@@ -94,13 +136,34 @@ func (gr *GeobinRequest) parseObject(o map[string]interface{}, kp []interface{})
 			Path: kp,
 			Geo:  o,
 		}
+		// GeoJSON that can't be converted to WGS84 is kept as it is, and validating it says why
+		if err := g.project(o, geojsonSRID(o)); err != nil {
+			debugLog("Couldn't convert GeoJSON to WGS84:", err)
+		}
+		g.Diagnostics = validateGeojson(o)
 		gr.appendGeo(g)
+	} else if geos, ok := topojsonGeos(o, kp); ok {
+		for _, g := range geos {
+			gr.appendGeo(g)
+		}
+	} else if geos, ok := esriGeos(o, kp); ok {
+		for _, g := range geos {
+			gr.appendGeo(g)
+		}
 	} else if foundGeo, geo := isOtherGeo(o); foundGeo {
 		geo.Path = kp
 		gr.appendGeo(*geo)
+		// the object isn't searched any further, so look for plus codes next to the location,
+		// which short codes need anyway
+		for _, g := range plusCodeGeos(o, geo, kp) {
+			gr.appendGeo(g)
+		}
+	} else if geo, ok := utmGeo(o); ok {
+		geo.Path = kp
+		gr.appendGeo(*geo)
 	} else {
 		for k, v := range o {
-			gr.parse(v, append(kp, k))
+			gr.parse(v, appendPath(kp, k))
 		}
 	}
 }
@@ -108,8 +171,104 @@ func (gr *GeobinRequest) parseObject(o map[string]interface{}, kp []interface{})
 // parseArray iterates over the given array calling `parse` with the item in a new goroutine.
 func (gr *GeobinRequest) parseArray(a []interface{}, kp []interface{}) {
 	for i, o := range a {
-		gr.parse(o, append(kp, i))
+		gr.parse(o, appendPath(kp, i))
+	}
+}
+
+// parseString checks to see if the given string is an encoded polyline or geohash under one of
+// their keys, or a full plus code, a latitude and longitude in degrees, minutes and seconds, an
+// MGRS grid reference, or a WKT, EWKT or hex encoded WKB geometry, and if so converts it to GeoJSON.
+func (gr *GeobinRequest) parseString(s string, kp []interface{}) {
+	if geo, ok := parsePolyline(s, kp); ok {
+		debugLog("Found encoded polyline:", geo)
+		gr.appendGeo(Geo{
+			Path: kp,
+			Geo:  geo,
+		})
+		return
+	}
+
+	if geos, ok := parseGeohash(s, kp); ok {
+		debugLog("Found geohash:", s)
+		for _, g := range geos {
+			gr.appendGeo(g)
+		}
+		return
+	}
+
+	if geos, ok := parsePlusCode(s, kp); ok {
+		debugLog("Found plus code:", s)
+		for _, g := range geos {
+			gr.appendGeo(g)
+		}
+		return
+	}
+
+	// WKT comes before degrees, minutes and seconds, as the S of an EWKT "SRID=4326;" prefix
+	// would otherwise be taken for a hemisphere
+	if geo, srid, err := parseEWKT(s); err == nil {
+		g := Geo{
+			Path: kp,
+			Geo:  geo,
+		}
+
+		if err = g.project(geo, srid); err != nil {
+			debugLog("Invalid WKT coordinates:", err)
+			return
+		}
+
+		debugLog("Found WKT:", geo)
+		gr.appendGeo(g)
+		return
+	} else if err != errNotWKT {
+		debugLog("Couldn't parse WKT:", err)
+		return
+	}
+
+	if lng, lat, err := parseDMSPair(s); err == nil {
+		debugLog("Found degrees, minutes and seconds:", s)
+		gr.appendGeo(Geo{
+			Path:           kp,
+			Geo:            newGeometry("Point", newPosition(lng, lat)),
+			Interpretation: interpDMS,
+		})
+		return
+	} else if err != errNotDMS {
+		debugLog("Couldn't parse degrees, minutes and seconds:", err)
+		return
 	}
+
+	if geos, err := parseMGRS(s, kp); err == nil {
+		debugLog("Found MGRS grid reference:", s)
+		for _, g := range geos {
+			gr.appendGeo(g)
+		}
+		return
+	} else if err != errNotMGRS {
+		debugLog("Couldn't parse MGRS grid reference:", err)
+		return
+	}
+
+	geo, srid, err := parseHexWKB(s)
+	if err == errNotWKB {
+		return
+	} else if err != nil {
+		debugLog("Couldn't parse WKB:", err)
+		return
+	}
+
+	g := Geo{
+		Path: kp,
+		Geo:  geo,
+	}
+
+	if err = g.project(geo, srid); err != nil {
+		debugLog("Invalid WKB coordinates:", err)
+		return
+	}
+
+	debugLog("Found WKB:", geo)
+	gr.appendGeo(g)
 }
 
 // isOtherGeo searches for non-standard geo data in the given json map. It looks for the presence
@@ -119,6 +278,12 @@ func (gr *GeobinRequest) parseArray(a []interface{}, kp []interface{}) {
 // any keys that hold an array of two numbers with a key name that suggests that it might
 // be a lng/lat array.
 //
+// Latitudes and longitudes can also be strings, holding a number or degrees, minutes and
+// seconds (45°31'12"N), and the pair keys can hold a string with both in it ("45.52,-122.68").
+// How they were read is recorded as the Interpretation of the Geo. Values that are obviously Web
+// Mercator meters rather than degrees, as x and y often are, are converted to longitude and
+// latitude.
+//
 // The following keys will be detected as Latitude:
 //	"lat", "latitude"
 //	"y"
@@ -136,38 +301,53 @@ func (gr *GeobinRequest) parseArray(a []interface{}, kp []interface{}) {
 //	"geo"
 //	"loc" or "location"
 //	"coord", "coords", "coordinate" or "coordinates"
+//	"pos" or "position"
+//	"lnglat" or "lonlat"
+//	"latlng" or "latlon" (lat/long instead)
 func isOtherGeo(o map[string]interface{}) (bool, *Geo) {
 	var foundLat, foundLng, foundDst bool
 	var lat, lng, dst float64
+	var latInterp, lngInterp string
 
 	for k, v := range o {
-		switch strings.ToLower(k) {
-		case "lat", "latitude", "y":
-			lat, foundLat = v.(float64)
-		case "lng", "lon", "long", "longitude", "x":
-			lng, foundLng = v.(float64)
-		case "dst", "dist", "distance", "rad", "radius", "acc", "accuracy":
+		switch otherGeoKey(k) {
+		case otherGeoLat:
+			lat, latInterp, foundLat = parseCoordinate(v, true)
+		case otherGeoLng:
+			lng, lngInterp, foundLng = parseCoordinate(v, false)
+		case otherGeoDst:
 			dst, foundDst = v.(float64)
-		case "geo", "loc", "location", "coord", "coordinate", "coords", "coordinates":
-			g, ok := v.([]float64)
-			if !ok || len(g) != 2 {
+		case otherGeoPair:
+			x, y, interp, ok := otherGeoPairValue(k, v)
+			if !ok {
 				break
 			}
 
-			lng, lat = g[0], g[1]
+			lng, lat = x, y
+			latInterp, lngInterp = interp, interp
 			foundLat, foundLng = true, true
 		}
 	}
 
-	if foundLat && foundLng && latIsValid(lat) && lngIsValid(lng) {
+	if foundLat && foundLng {
 		p := gj.NewPoint(gj.Coordinate{gj.CoordType(lng), gj.CoordType(lat)})
 		pstr, _ := gj.Marshal(p)
 		var geo map[string]interface{}
 		json.Unmarshal([]byte(pstr), &geo)
-		debugLog("Found other geo:", geo)
 		g := &Geo{
 			Geo: geo,
 		}
+		// this checks that the position is valid, and converts x and y in Web Mercator meters
+		if err := g.project(geo, 0); err != nil {
+			return false, nil
+		}
+		debugLog("Found other geo:", geo)
+		// numbers in degrees, minutes and seconds say more about how they were read than numbers
+		// in strings do
+		g.Interpretation = latInterp
+		if latInterp == "" || lngInterp == interpDMS {
+			g.Interpretation = lngInterp
+		}
 		if foundDst {
 			g.Radius = dst
 		}
@@ -177,6 +357,64 @@ func isOtherGeo(o map[string]interface{}) (bool, *Geo) {
 	return false, nil
 }
 
+// the kinds of key that isOtherGeo looks for
+const (
+	otherGeoLat = iota + 1
+	otherGeoLng
+	otherGeoDst
+	otherGeoPair
+)
+
+// otherGeoKey returns the kind of value that isOtherGeo expects the given key to hold, or
+// zero if it isn't one of the keys it looks for. Keys are matched case insensitively.
+func otherGeoKey(k string) int {
+	switch strings.ToLower(k) {
+	case "lat", "latitude", "y":
+		return otherGeoLat
+	case "lng", "lon", "long", "longitude", "x":
+		return otherGeoLng
+	case "dst", "dist", "distance", "rad", "radius", "acc", "accuracy":
+		return otherGeoDst
+	case "geo", "loc", "location", "coord", "coordinate", "coords", "coordinates",
+		"pos", "position", "latlng", "latlon", "lnglat", "lonlat":
+		return otherGeoPair
+	}
+	return 0
+}
+
+// otherGeoPairValue reads the longitude and latitude held by one of the pair keys. An array of two
+// numbers is longitude first, unless the key is "latlng" or "latlon". A string is read with
+// parseCoordinatePair, longitude first if the key is "lnglat" or "lonlat".
+func otherGeoPairValue(k string, v interface{}) (lng, lat float64, interp string, ok bool) {
+	order := strings.ToLower(k)
+	switch t := v.(type) {
+	case []float64:
+		if len(t) != 2 {
+			return 0, 0, "", false
+		}
+		lng, lat = t[0], t[1]
+	case []interface{}:
+		if len(t) != 2 {
+			return 0, 0, "", false
+		}
+		x, xok := t[0].(float64)
+		y, yok := t[1].(float64)
+		if !xok || !yok {
+			return 0, 0, "", false
+		}
+		lng, lat = x, y
+	case string:
+		return parseCoordinatePair(t, order == "lnglat" || order == "lonlat")
+	default:
+		return 0, 0, "", false
+	}
+
+	if order == "latlng" || order == "latlon" {
+		lng, lat = lat, lng
+	}
+	return lng, lat, "", true
+}
+
 // isGeojson detects whether or not the given json map is valid GeoJSON and
 // returns a boolean reflecting its findings.
 func isGeojson(js map[string]interface{}) bool {
@@ -211,6 +449,13 @@ func isGeojson(js map[string]interface{}) bool {
 			return false
 		}
 
+		return true
+	case "MultiLineString":
+		var mls gj.MultiLineString
+		if err = unmarshal(b, &mls); err != nil {
+			return false
+		}
+
 		return true
 	case "Polygon":
 		var p gj.Polygon
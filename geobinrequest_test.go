@@ -91,6 +91,15 @@ func TestRequestWithMultipleObjects(t *testing.T) {
 				"coordinates": []interface{}{float64(0), float64(100)},
 			},
 			"path": []interface{}{float64(1)},
+			// it's still GeoJSON, but its latitude is out of range
+			"diagnostics": []interface{}{
+				map[string]interface{}{
+					"severity": "error",
+					"code":     "latitude-out-of-range",
+					"message":  "latitude 100 is outside of -90 to 90",
+					"path":     []interface{}{"coordinates"},
+				},
+			},
 		},
 	}
 
@@ -5,7 +5,6 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
-	"strconv"
 	"time"
 )
 
@@ -17,17 +16,17 @@ func init() {
 type geobinServer struct {
 	*http.ServeMux
 	conf *Config
-	RedisClient
+	Store
 	PubSubber
 	SocketMap
 }
 
-func NewGeobinServer(c *Config, rc RedisClient, ps PubSubber, sm SocketMap) *geobinServer {
+func NewGeobinServer(c *Config, st Store, ps PubSubber, sm SocketMap) *geobinServer {
 	gbs := geobinServer{
-		conf:        c,
-		RedisClient: rc,
-		PubSubber:   ps,
-		SocketMap:   sm,
+		conf:      c,
+		Store:     st,
+		PubSubber: ps,
+		SocketMap: sm,
 	}
 
 	gbs.ServeMux = gbs.createRouter()
@@ -67,15 +66,28 @@ func (gb *geobinServer) createRouter() *http.ServeMux {
 		}
 	}
 
+	// this works like apiRoute, but also passes DELETE requests through to the handler
+	deletableAPIRoute := func(h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+		return func(w http.ResponseWriter, req *http.Request) {
+			if req.Method == "DELETE" {
+				h(w, req)
+				return
+			}
+			apiRoute(h)(w, req)
+		}
+	}
+
 	r.HandleFunc("/api/1/counts", apiRoute(gb.countsHandler))
 	r.HandleFunc("/api/1/create", apiRoute(gb.rateLimit(gb.createHandler, gb.conf.RateLimit)))
-	r.HandleFunc("/api/1/history/", apiRoute(gb.rateLimit(gb.historyHandler, gb.conf.RateLimit))) // /api/1/history/{bin_id}
-	r.HandleFunc("/api/1/ws/", gb.wsHandler)                                                      // /api/1/ws/{bin_id}
+	r.HandleFunc("/api/1/import", apiRoute(gb.rateLimit(gb.importHandler, gb.conf.RateLimit)))
+	r.HandleFunc("/api/1/history/", apiRoute(gb.rateLimit(gb.historyHandler, gb.conf.RateLimit)))    // /api/1/history/{bin_id}
+	r.HandleFunc("/api/1/bins/", deletableAPIRoute(gb.rateLimit(gb.binsHandler, gb.conf.RateLimit))) // /api/1/bins/{bin_id}/{action}
+	r.HandleFunc("/api/1/ws/", gb.wsHandler)                                                         // /api/1/ws/{bin_id}
 
 	return r
 }
 
-// rateLimit uses redis to enforce rate limits per route. This middleware should
+// rateLimit uses the Store's counters to enforce rate limits per route. This middleware should
 // only be used on routes that contain binIds or other unique identifiers,
 // otherwise the rate limit will be globally applied, instead of scoped to a
 // particular bin.
@@ -85,28 +97,18 @@ func (gb *geobinServer) rateLimit(h http.HandlerFunc, requestsPerSec int) http.H
 		ts := time.Now().Unix()
 		key := fmt.Sprintf("rate-limit:%s:%d", url, ts)
 
-		exists, err := gb.Exists(key)
+		reqCount, err := gb.Incr(key, 5*time.Second)
 		if err != nil {
 			log.Println(err)
+			http.Error(w, "API Error", http.StatusServiceUnavailable)
+			return
 		}
 
-		if exists {
-			res, err := gb.RedisClient.Get(key)
-			if err != nil {
-				http.Error(w, "API Error", http.StatusServiceUnavailable)
-				return
-			}
-
-			reqCount, _ := strconv.Atoi(res)
-			if reqCount >= requestsPerSec {
-				http.Error(w, "Rate limit exceeded. Wait a moment and try again.", http.StatusInternalServerError)
-				return
-			}
+		if reqCount > int64(requestsPerSec) {
+			http.Error(w, "Rate limit exceeded. Wait a moment and try again.", http.StatusInternalServerError)
+			return
 		}
 
-		gb.Incr(key)
-		gb.Expire(key, 5*time.Second)
-
 		h.ServeHTTP(w, r)
 	}
 }
@@ -120,7 +122,7 @@ func (gb *geobinServer) randomString(length int) (string, error) {
 
 	s := string(b)
 
-	exists, err := gb.Exists(s)
+	exists, err := gb.BinExists(s)
 	if err != nil {
 		log.Println("Failure to EXISTS for:", s, err)
 		return "", err
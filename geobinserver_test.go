@@ -19,31 +19,56 @@ import (
 )
 
 var testConf = &Config{
-	"localhost",
-	8080,
-	"127.0.0.1:6379",
-	"",
-	0,
-	"023456789abcdefghjkmnopqrstuvwxyzABCDEFGHJKMNOPQRSTUVWXYZ",
-	10,
-	999,
+	Host:       "localhost",
+	Port:       8080,
+	Store:      storeRedis,
+	RedisHost:  "127.0.0.1:6379",
+	RedisPass:  "",
+	RedisDB:    0,
+	BoltPath:   defaultBoltPath,
+	SQLitePath: defaultSQLitePath,
+	NameVals:   "023456789abcdefghjkmnopqrstuvwxyzABCDEFGHJKMNOPQRSTUVWXYZ",
+	NameLength: 10,
+	BinTTL:     int64(defaultBinTTL / time.Second),
+	MaxBinTTL:  int64(defaultMaxBinTTL / time.Second),
+	RateLimit:  999,
 }
 
 type MockRedis struct {
 	sync.Mutex
-	bins  map[string][]string
-	incrs map[string]string
+	bins    map[string][]string
+	incrs   map[string]string
+	hashes  map[string]map[string]string
+	expires map[string]time.Time
 }
 
 type MockPubSub struct{}
 
 func NewMockRedis() *MockRedis {
 	return &MockRedis{
-		bins:  make(map[string][]string),
-		incrs: make(map[string]string),
+		bins:    make(map[string][]string),
+		incrs:   make(map[string]string),
+		hashes:  make(map[string]map[string]string),
+		expires: make(map[string]time.Time),
 	}
 }
 
+// hasKey reports whether key exists, deleting it first if it has expired, the way redis
+// does when an expired key is looked at. mr must be locked.
+func (mr *MockRedis) hasKey(key string) bool {
+	if exp, ok := mr.expires[key]; ok && !time.Now().Before(exp) {
+		delete(mr.bins, key)
+		delete(mr.incrs, key)
+		delete(mr.hashes, key)
+		delete(mr.expires, key)
+	}
+
+	_, bin := mr.bins[key]
+	_, incr := mr.incrs[key]
+	_, hash := mr.hashes[key]
+	return bin || incr || hash
+}
+
 func (mr *MockRedis) ZAdd(key string, members ...redis.Z) (int64, error) {
 	mr.Lock()
 	defer mr.Unlock()
@@ -68,11 +93,15 @@ func (mr *MockRedis) ZCount(key, min, max string) (int64, error) {
 }
 
 func (mr *MockRedis) Expire(key string, dur time.Duration) (bool, error) {
-	return true, nil
-}
+	mr.Lock()
+	defer mr.Unlock()
 
-func (mr *MockRedis) Publish(channel, message string) (int64, error) {
-	return 1, nil
+	if !mr.hasKey(key) {
+		return false, nil
+	}
+
+	mr.expires[key] = time.Now().Add(dur)
+	return true, nil
 }
 
 func (mr *MockRedis) ZRevRange(key, start, stop string) ([]string, error) {
@@ -90,13 +119,96 @@ func (mr *MockRedis) ZRevRange(key, start, stop string) ([]string, error) {
 	return reversed, nil
 }
 
+func (mr *MockRedis) HGet(key, field string) (string, error) {
+	mr.Lock()
+	defer mr.Unlock()
+
+	if v, ok := mr.hashes[key][field]; ok {
+		return v, nil
+	}
+	return "", redis.Nil
+}
+
+// MockRedis doesn't keep scores, so ZAddTrimmed trims the members that were added first
+func (mr *MockRedis) ZAddTrimmed(key, usageKey string, member redis.Z, r retention) (int64, error) {
+	mr.Lock()
+	defer mr.Unlock()
+
+	if _, ok := mr.bins[key]; !ok {
+		return 0, errBinNotFound
+	}
+	mr.bins[key] = append(mr.bins[key], member.Member)
+
+	var count, bytes, dropped int64
+	members := make([]string, 0, len(mr.bins[key]))
+	for _, m := range mr.bins[key] {
+		if m != "" {
+			members = append(members, m)
+			count++
+			bytes += int64(len(m))
+		}
+	}
+
+	for r.exceeded(count, bytes) {
+		count--
+		bytes -= int64(len(members[dropped]))
+		dropped++
+	}
+	mr.bins[key] = append([]string{""}, members[dropped:]...)
+
+	if _, ok := mr.hashes[usageKey]; !ok {
+		mr.hashes[usageKey] = map[string]string{"dropped": "0"}
+	}
+	total, _ := strconv.ParseInt(mr.hashes[usageKey]["dropped"], 10, 64)
+	mr.hashes[usageKey]["dropped"] = strconv.FormatInt(total+dropped, 10)
+	return dropped, nil
+}
+
+// MockRedis doesn't keep scores, so ZRangeByScore and ZRevRangeByScore ignore Min and Max
+// and only leave out the placeholder member
+func (mr *MockRedis) ZRangeByScore(key string, opt redis.ZRangeByScore) ([]string, error) {
+	set, err := mr.ZRevRange(key, "0", "-1")
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(set)-1; i < j; i, j = i+1, j-1 {
+		set[i], set[j] = set[j], set[i]
+	}
+	return mockRangeLimit(set, opt), nil
+}
+
+func (mr *MockRedis) ZRevRangeByScore(key string, opt redis.ZRangeByScore) ([]string, error) {
+	set, err := mr.ZRevRange(key, "0", "-1")
+	if err != nil {
+		return nil, err
+	}
+	return mockRangeLimit(set, opt), nil
+}
+
+func mockRangeLimit(set []string, opt redis.ZRangeByScore) []string {
+	members := make([]string, 0, len(set))
+	for _, m := range set {
+		if m != "" {
+			members = append(members, m)
+		}
+	}
+
+	if opt.Offset >= int64(len(members)) {
+		return []string{}
+	}
+	members = members[opt.Offset:]
+	if opt.Count >= 0 && opt.Count < int64(len(members)) {
+		members = members[:opt.Count]
+	}
+	return members
+}
+
 func (mr *MockRedis) Exists(key string) (bool, error) {
 	mr.Lock()
 	defer mr.Unlock()
-	_, bin := mr.bins[key]
-	_, incr := mr.incrs[key]
 
-	return bin || incr, nil
+	return mr.hasKey(key), nil
 }
 
 // currently Get() is only used for checking on integer values during ratelimiting
@@ -127,6 +239,70 @@ func (mr *MockRedis) Incr(key string) (int64, error) {
 	return int64(incrd), nil
 }
 
+// MockRedis ignores match, and scans its keys in order, with the cursor as the index of the
+// next one
+func (mr *MockRedis) Scan(cursor int64, match string, count int64) (int64, []string, error) {
+	mr.Lock()
+	defer mr.Unlock()
+
+	keys := make([]string, 0, len(mr.bins)+len(mr.incrs))
+	for k := range mr.bins {
+		keys = append(keys, k)
+	}
+	for k := range mr.incrs {
+		keys = append(keys, k)
+	}
+	for k := range mr.hashes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if end := cursor + count; end < int64(len(keys)) {
+		return end, keys[cursor:end], nil
+	}
+	return 0, keys[cursor:], nil
+}
+
+// MockRedis answers TTL like redis does, with -2s for a missing key and -1s for a key that
+// doesn't expire
+func (mr *MockRedis) TTL(key string) (time.Duration, error) {
+	mr.Lock()
+	defer mr.Unlock()
+
+	if !mr.hasKey(key) {
+		return -2 * time.Second, nil
+	}
+
+	exp, ok := mr.expires[key]
+	if !ok {
+		return -1 * time.Second, nil
+	}
+	return exp.Sub(time.Now()), nil
+}
+
+func (mr *MockRedis) Del(keys ...string) (int64, error) {
+	mr.Lock()
+	defer mr.Unlock()
+
+	var n int64
+	for _, k := range keys {
+		delete(mr.expires, k)
+		if _, ok := mr.bins[k]; ok {
+			delete(mr.bins, k)
+			n++
+		}
+		if _, ok := mr.hashes[k]; ok {
+			delete(mr.hashes, k)
+			n++
+		}
+		if _, ok := mr.incrs[k]; ok {
+			delete(mr.incrs, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
 func (mps *MockPubSub) Subscribe(channels ...string) error {
 	return nil
 }
@@ -135,6 +311,10 @@ func (mps *MockPubSub) Unsubscribe(channels ...string) error {
 	return nil
 }
 
+func (mps *MockPubSub) Publish(channel, message string) error {
+	return nil
+}
+
 func TestCreateHandler(t *testing.T) {
 	req, err := http.NewRequest("POST", "http://testing.geobin.io/api/1/create", nil)
 	if err != nil {
@@ -148,6 +328,213 @@ func TestCreateHandler(t *testing.T) {
 	assertBodyContainsKey(w.Body, "expires", t)
 }
 
+func TestCreateHandlerWithTTL(t *testing.T) {
+	gbs := createGeobinServer()
+	runTest := func(body string, code int, expected time.Duration) {
+		req, err := http.NewRequest("POST", "http://testing.geobin.io/api/1/create", strings.NewReader(body))
+		if err != nil {
+			t.Error(err)
+		}
+		w := httptest.NewRecorder()
+		gbs.ServeHTTP(w, req)
+
+		assertResponseCode(w, code, t)
+		if code == http.StatusOK {
+			assertExpires(w.Body, expected, t)
+		}
+	}
+
+	runTest(`{}`, http.StatusOK, defaultBinTTL)
+	runTest(`{"ttl": 3600}`, http.StatusOK, time.Hour)
+	// asking for too long should get the longest we allow
+	runTest(`{"ttl": 999999999}`, http.StatusOK, defaultMaxBinTTL)
+	runTest(`{"ttl": -1}`, http.StatusBadRequest, 0)
+	runTest(`{"ttl": "forever"}`, http.StatusBadRequest, 0)
+}
+
+func TestCreateHandlerDefaultTTLOverMax(t *testing.T) {
+	conf := *testConf
+	conf.BinTTL = conf.MaxBinTTL * 2
+	ps := &MockPubSub{}
+	gbs := NewGeobinServer(&conf, NewRedisStore(NewMockRedis()), ps, NewSocketMap(ps))
+
+	req, err := http.NewRequest("POST", "http://testing.geobin.io/api/1/create", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	w := httptest.NewRecorder()
+	gbs.ServeHTTP(w, req)
+
+	assertResponseOK(w, t)
+	assertExpires(w.Body, defaultMaxBinTTL, t)
+}
+
+func TestExpiryHandler(t *testing.T) {
+	testExpiryHandler(t, newMemoryBackend())
+}
+
+func TestExpiryHandlerRedis(t *testing.T) {
+	testExpiryHandler(t, newMockRedisBackend())
+}
+
+func testExpiryHandler(t *testing.T, be *backend) {
+	sm := NewSocketMap(be.PubSubber)
+	go be.pump(sm)
+	gbs := NewGeobinServer(testConf, be.Store, be.PubSubber, sm)
+	binId, err := createBin(gbs)
+	if err != nil {
+		t.Error("Could not create bin")
+	}
+
+	ms := &MockSocket{name: "mock_socket"}
+	sm.Add(binId, "socket_uuid", ms)
+	gbs.Subscribe(binId)
+
+	runTest := func(id string, body string, code int, expected time.Duration) {
+		req, err := http.NewRequest("POST", "http://testing.geobin.io/api/1/bins/"+id+"/expiry", strings.NewReader(body))
+		if err != nil {
+			t.Error(err)
+		}
+		w := httptest.NewRecorder()
+		gbs.ServeHTTP(w, req)
+
+		assertResponseCode(w, code, t)
+		if code == http.StatusOK {
+			assertExpires(w.Body, expected, t)
+		}
+	}
+
+	runTest(binId, `{"ttl": 60}`, http.StatusOK, time.Minute)
+	runTest(binId, `{"extend": 60}`, http.StatusOK, 2*time.Minute)
+	runTest(binId, `{"extend": -30}`, http.StatusOK, 90*time.Second)
+	runTest(binId, `{"extend": 999999999}`, http.StatusOK, defaultMaxBinTTL)
+	runTest(binId, `{"extend": -999999999}`, http.StatusBadRequest, 0)
+	runTest(binId, `{}`, http.StatusBadRequest, 0)
+	runTest(binId, `{"ttl": 60, "extend": 60}`, http.StatusBadRequest, 0)
+	runTest("neverland", `{"ttl": 60}`, http.StatusNotFound, 0)
+
+	// the socket should have been told about each change
+	time.Sleep(25 * time.Millisecond)
+	payloads := ms.getPayloads()
+	assert.Equal(t, 4, len(payloads))
+	for _, p := range payloads {
+		assert.T(t, strings.HasPrefix(p, `{"event":"expiry","expires":`), p)
+	}
+}
+
+func TestDeleteHandler(t *testing.T) {
+	be := newMemoryBackend()
+	sm := NewSocketMap(be.PubSubber)
+	go be.pump(sm)
+	gbs := NewGeobinServer(testConf, be.Store, be.PubSubber, sm)
+	binId, err := createBin(gbs)
+	if err != nil {
+		t.Error("Could not create bin")
+	}
+
+	_, err = postToBin(gbs, binId, `{"lat": 10, "lng": -10}`)
+	if err != nil {
+		t.Error(err)
+	}
+
+	ms := &MockSocket{name: "mock_socket"}
+	sm.Add(binId, "socket_uuid", ms)
+	gbs.Subscribe(binId)
+
+	deleteBin := func() *httptest.ResponseRecorder {
+		req, err := http.NewRequest("DELETE", "http://testing.geobin.io/api/1/bins/"+binId, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		w := httptest.NewRecorder()
+		gbs.ServeHTTP(w, req)
+		return w
+	}
+
+	assertResponseCode(deleteBin(), http.StatusNoContent, t)
+	assertResponseNotFound(deleteBin(), t)
+
+	// the bin and its history should be gone
+	req, err := http.NewRequest("POST", "http://testing.geobin.io/api/1/history/"+binId, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	w := httptest.NewRecorder()
+	gbs.ServeHTTP(w, req)
+	assertResponseNotFound(w, t)
+
+	// and the socket should have been told about it, then closed
+	time.Sleep(25 * time.Millisecond)
+	assert.Equal(t, []string{`{"event":"deleted"}`}, ms.getPayloads())
+	assert.Equal(t, true, ms.getClosed())
+}
+
+func TestRetentionLimits(t *testing.T) {
+	conf := *testConf
+	conf.MaxBinRequests = 2
+	be := newMemoryBackend()
+	sm := NewSocketMap(be.PubSubber)
+	go be.pump(sm)
+	gbs := NewGeobinServer(&conf, be.Store, be.PubSubber, sm)
+	binId, err := createBin(gbs)
+	if err != nil {
+		t.Error("Could not create bin")
+	}
+
+	ms := &MockSocket{name: "mock_socket"}
+	sm.Add(binId, "socket_uuid", ms)
+	gbs.Subscribe(binId)
+
+	for i := 0; i < 3; i++ {
+		if _, err = postToBin(gbs, binId, fmt.Sprintf(`{"lat": %d, "lng": -10}`, i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// the sockets should hear about the request that was dropped. SocketMap.Send writes
+	// from separate goroutines, so the order isn't guaranteed.
+	time.Sleep(25 * time.Millisecond)
+	payloads := ms.getPayloads()
+	sort.Strings(payloads)
+	assert.Equal(t, 4, len(payloads))
+	assert.Equal(t, `{"dropped":1,"event":"dropped"}`, payloads[0])
+
+	req, err := http.NewRequest("POST", "http://testing.geobin.io/api/1/bins/"+binId, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	w := httptest.NewRecorder()
+	gbs.ServeHTTP(w, req)
+	assertResponseOK(w, t)
+
+	var info map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, binId, info["id"])
+	assert.Equal(t, float64(2), info["count"])
+	assert.Equal(t, float64(1), info["dropped"])
+}
+
+func TestBinsHandler404(t *testing.T) {
+	gbs := createGeobinServer()
+	binId, err := createBin(gbs)
+	if err != nil {
+		t.Error("Could not create bin")
+	}
+
+	for _, path := range []string{"unknown_bin", binId + "/unknown", binId + "/expiry/more"} {
+		req, err := http.NewRequest("POST", "http://testing.geobin.io/api/1/bins/"+path, strings.NewReader(`{"ttl": 60}`))
+		if err != nil {
+			t.Error(err)
+		}
+		w := httptest.NewRecorder()
+		gbs.ServeHTTP(w, req)
+
+		assertResponseNotFound(w, t)
+	}
+}
+
 func TestBinHandler404(t *testing.T) {
 	// Test 404 for nonexistant bin
 	req, err := http.NewRequest("POST", "http://testing.geobin.io/nonexistant_bin", nil)
@@ -385,9 +772,33 @@ func assertBodyContainsKey(body *bytes.Buffer, key string, t *testing.T) {
 	}
 }
 
+// assertExpires checks that the "expires" timestamp in the body is about d from now.
+func assertExpires(body *bytes.Buffer, d time.Duration, t *testing.T) {
+	var b map[string]interface{}
+	json.Unmarshal(body.Bytes(), &b)
+	exp, ok := b["expires"].(float64)
+	if !ok {
+		t.Error("response doesn't contain 'expires'")
+		return
+	}
+
+	expected := time.Now().Add(d).Unix()
+	if diff := int64(exp) - expected; diff < -1 || diff > 1 {
+		t.Errorf("Expected expires to be about %d, got %d", expected, int64(exp))
+	}
+}
+
+// newMockRedisBackend creates a backend that keeps bins in a MockRedis, with the memory
+// backend's pubsub.
+func newMockRedisBackend() *backend {
+	be := newMemoryBackend()
+	be.Store = NewRedisStore(NewMockRedis())
+	return be
+}
+
 func createGeobinServer() *geobinServer {
 	ps := &MockPubSub{}
-	return NewGeobinServer(testConf, NewMockRedis(), ps, NewSocketMap(ps))
+	return NewGeobinServer(testConf, NewRedisStore(NewMockRedis()), ps, NewSocketMap(ps))
 }
 
 func createBin(gbs *geobinServer) (string, error) {
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// geohashBase32 is the alphabet geohashes are written in, which leaves out a, i, l and o.
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// maxGeohashLength is the longest geohash we decode, which is already well under a millimeter.
+const maxGeohashLength = 12
+
+var errInvalidGeohash = errors.New("invalid geohash")
+
+// isGeohashKey reports whether a string under the key at the end of the given path should be
+// decoded as a geohash. Keys are matched case insensitively.
+func isGeohashKey(kp []interface{}) bool {
+	switch strings.ToLower(lastKey(kp)) {
+	case "geohash", "geo_hash", "geo-hash":
+		return true
+	}
+	return false
+}
+
+// parseGeohash decodes s, if it is a geohash under one of the geohash keys, into the Polygon of
+// its cell and the Point at the cell's center. Both are Features with the geohash and its
+// precision, the number of characters in it, as properties. It returns false if the key isn't
+// a geohash key or s isn't a valid geohash.
+func parseGeohash(s string, kp []interface{}) ([]Geo, bool) {
+	if !isGeohashKey(kp) {
+		return nil, false
+	}
+
+	west, south, east, north, err := decodeGeohash(s)
+	if err != nil {
+		debugLog("Couldn't decode geohash:", err)
+		return nil, false
+	}
+
+	props := map[string]interface{}{
+		"geohash":   strings.ToLower(s),
+		"precision": len(s),
+	}
+	return cellGeos(kp, west, south, east, north, props), true
+}
+
+// decodeGeohash returns the bounds of the cell that the geohash s stands for. Each character
+// holds five bits, which alternately halve the cell's longitude and latitude ranges, starting
+// with longitude.
+func decodeGeohash(s string) (west, south, east, north float64, err error) {
+	if len(s) == 0 || len(s) > maxGeohashLength {
+		return 0, 0, 0, 0, errInvalidGeohash
+	}
+
+	west, south, east, north = -180, -90, 180, 90
+	isLng := true
+	for i := 0; i < len(s); i++ {
+		n := strings.IndexByte(geohashBase32, lowerByte(s[i]))
+		if n < 0 {
+			return 0, 0, 0, 0, errInvalidGeohash
+		}
+
+		for bit := 4; bit >= 0; bit-- {
+			set := n&(1<<uint(bit)) != 0
+			if isLng {
+				if mid := (west + east) / 2; set {
+					west = mid
+				} else {
+					east = mid
+				}
+			} else {
+				if mid := (south + north) / 2; set {
+					south = mid
+				} else {
+					north = mid
+				}
+			}
+			isLng = !isLng
+		}
+	}
+	return west, south, east, north, nil
+}
+
+// cellGeos returns a grid cell, such as a geohash, as two Features: the Polygon of its bounds and
+// the Point at its center. Both have the given path and properties.
+func cellGeos(kp []interface{}, west, south, east, north float64, props map[string]interface{}) []Geo {
+	ring := []interface{}{
+		newPosition(west, south),
+		newPosition(east, south),
+		newPosition(east, north),
+		newPosition(west, north),
+		newPosition(west, south),
+	}
+	return ringCellGeos(kp, ring, newPosition((west+east)/2, (south+north)/2), props)
+}
+
+// ringCellGeos returns a grid cell that isn't lined up with longitude and latitude, such as an
+// MGRS square, as the Polygon of the given ring and the Point at the given center.
+func ringCellGeos(kp []interface{}, ring []interface{}, center []interface{}, props map[string]interface{}) []Geo {
+	return []Geo{
+		Geo{Geo: newFeature(newGeometry("Polygon", []interface{}{ring}), props), Path: kp},
+		Geo{Geo: newFeature(newGeometry("Point", center), props), Path: kp},
+	}
+}
+
+// lowerByte lower cases an ASCII letter.
+func lowerByte(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
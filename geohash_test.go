@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestDecodeGeohash(t *testing.T) {
+	west, south, east, north, err := decodeGeohash("ezs42")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []float64{-5.625, 42.5830078125, -5.5810546875, 42.626953125}, []float64{west, south, east, north})
+
+	west, south, east, north, err = decodeGeohash("U")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []float64{0, 45, 45, 90}, []float64{west, south, east, north})
+
+	for _, s := range []string{"", "ezs4a", "ezs 42", "ezs42ezs42ezs"} {
+		_, _, _, _, err := decodeGeohash(s)
+		assert.Equal(t, errInvalidGeohash, err, s)
+	}
+}
+
+func TestParseGeohashInRequest(t *testing.T) {
+	gr := NewGeobinRequest(0, nil, []byte(`{
+		"event": {"geohash": "s"},
+		"visits": {"GeoHash": ["ezs42"]},
+		"name": "ezs42",
+		"geo_hash": "not a geohash"
+	}`))
+
+	cell := func(west, south, east, north float64, hash string, kp ...interface{}) []Geo {
+		return cellGeos(kp, west, south, east, north, map[string]interface{}{
+			"geohash":   hash,
+			"precision": len(hash),
+		})
+	}
+	exp := cell(0, 0, 45, 45, "s", "event", "geohash")
+	exp = append(exp, cell(-5.625, 42.5830078125, -5.5810546875, 42.626953125, "ezs42", "visits", "GeoHash", 0)...)
+
+	assert.Equal(t, newGeometry("Point", newPosition(22.5, 22.5)), exp[1].Geo["geometry"])
+	testSlicesContainSameGeos(t, exp, gr.Geo)
+}
+
+func TestParseGeohashDeeplyNested(t *testing.T) {
+	// sibling values are parsed at the same time, so their paths mustn't share a backing array
+	for i := 0; i < 100; i++ {
+		gr := NewGeobinRequest(0, nil, []byte(`{"a": {"b": {"c": {
+			"geohash": "ezs42",
+			"name": "ezs43",
+			"note": "s"
+		}}}}`))
+
+		assert.Equal(t, 2, len(gr.Geo))
+		for _, g := range gr.Geo {
+			assert.Equal(t, []interface{}{"a", "b", "c", "geohash"}, g.Path)
+			assert.Equal(t, "ezs42", g.Geo["properties"].(map[string]interface{})["geohash"])
+		}
+	}
+}
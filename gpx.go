@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+)
+
+// gpxDoc holds the parts of a GPX document that we turn into geo data.
+type gpxDoc struct {
+	XMLName   xml.Name   `xml:"gpx"`
+	Waypoints []gpxPoint `xml:"wpt"`
+	Routes    []struct {
+		Name   string     `xml:"name"`
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// gpxPoint is a wpt, rtept or trkpt. Its lat and lon are pointers so that points missing
+// either can be told apart from points at 0,0.
+type gpxPoint struct {
+	Lat  *float64 `xml:"lat,attr"`
+	Lon  *float64 `xml:"lon,attr"`
+	Ele  *float64 `xml:"ele"`
+	Time string   `xml:"time"`
+	Name string   `xml:"name"`
+	Desc string   `xml:"desc"`
+}
+
+var errInvalidGPXPoint = errors.New("GPX point out of range")
+
+func sniffGPX(body []byte) bool {
+	return sniffXML(body, "gpx")
+}
+
+// parseGPX finds the waypoints, routes and tracks in a GPX document. Waypoints become Point
+// Features, with their name, description, time and elevation as properties. Routes and each
+// segment of a track become LineString Features, with the time and elevation of each of their
+// points kept in "coordTimes" and "coordElevations" properties. Points missing their lat or lon
+// are skipped. The paths of the geo data are the elements they came from, such as
+// ["trk", 0, "trkseg", 1].
+func parseGPX(body []byte) ([]Geo, error) {
+	var doc gpxDoc
+	if err := xml.NewDecoder(bytes.NewReader(body)).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	geos := make([]Geo, 0)
+	for i, p := range doc.Waypoints {
+		if !p.located() {
+			continue
+		}
+		if !p.valid() {
+			return nil, errInvalidGPXPoint
+		}
+
+		props := p.properties()
+		if p.Name != "" {
+			props["name"] = p.Name
+		}
+		if p.Desc != "" {
+			props["desc"] = p.Desc
+		}
+
+		geos = append(geos, Geo{
+			Geo:  newFeature(newGeometry("Point", newPosition(*p.Lon, *p.Lat)), props),
+			Path: []interface{}{"wpt", i},
+		})
+	}
+
+	for i, r := range doc.Routes {
+		f, err := gpxLine(r.Name, r.Points)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			geos = append(geos, Geo{Geo: f, Path: []interface{}{"rte", i}})
+		}
+	}
+
+	for i, t := range doc.Tracks {
+		for j, s := range t.Segments {
+			f, err := gpxLine(t.Name, s.Points)
+			if err != nil {
+				return nil, err
+			}
+			if f != nil {
+				geos = append(geos, Geo{Geo: f, Path: []interface{}{"trk", i, "trkseg", j}})
+			}
+		}
+	}
+
+	return geos, nil
+}
+
+// gpxLine creates a LineString Feature from the points in a route or track segment, or a Point
+// if there's only one of them. It returns nil if there are no points with a lat and lon.
+func gpxLine(name string, all []gpxPoint) (map[string]interface{}, error) {
+	points := make([]gpxPoint, 0, len(all))
+	for _, p := range all {
+		if !p.located() {
+			continue
+		}
+		if !p.valid() {
+			return nil, errInvalidGPXPoint
+		}
+		points = append(points, p)
+	}
+
+	if len(points) == 0 {
+		return nil, nil
+	}
+
+	if len(points) == 1 {
+		props := points[0].properties()
+		if name != "" {
+			props["name"] = name
+		}
+		return newFeature(newGeometry("Point", newPosition(*points[0].Lon, *points[0].Lat)), props), nil
+	}
+
+	coords := make([]interface{}, len(points))
+	times := make([]interface{}, len(points))
+	eles := make([]interface{}, len(points))
+	var hasTimes, hasEles bool
+	for i, p := range points {
+		coords[i] = newPosition(*p.Lon, *p.Lat)
+		if p.Time != "" {
+			times[i], hasTimes = p.Time, true
+		}
+		if p.Ele != nil {
+			eles[i], hasEles = *p.Ele, true
+		}
+	}
+
+	props := make(map[string]interface{})
+	if name != "" {
+		props["name"] = name
+	}
+	if hasTimes {
+		props["coordTimes"] = times
+	}
+	if hasEles {
+		props["coordElevations"] = eles
+	}
+	return newFeature(newGeometry("LineString", coords), props), nil
+}
+
+func (p gpxPoint) located() bool {
+	return p.Lat != nil && p.Lon != nil
+}
+
+func (p gpxPoint) valid() bool {
+	return latIsValid(*p.Lat) && lngIsValid(*p.Lon)
+}
+
+// properties returns the time and elevation of the point, if it has them.
+func (p gpxPoint) properties() map[string]interface{} {
+	props := make(map[string]interface{})
+	if p.Time != "" {
+		props["time"] = p.Time
+	}
+	if p.Ele != nil {
+		props["ele"] = *p.Ele
+	}
+	return props
+}
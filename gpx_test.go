@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+const testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <wpt lat="45.52" lon="-122.68">
+    <ele>15.5</ele>
+    <time>2014-05-19T22:38:53Z</time>
+    <name>Esri PDX</name>
+  </wpt>
+  <rte>
+    <name>Route</name>
+    <rtept lat="45.5" lon="-122.6"/>
+    <rtept lat="45.6" lon="-122.7"/>
+  </rte>
+  <trk>
+    <name>Morning</name>
+    <trkseg>
+      <trkpt lat="45.1" lon="-122.1"><ele>10</ele><time>2014-05-19T22:00:00Z</time></trkpt>
+      <trkpt lat="45.2" lon="-122.2"><ele>11</ele><time>2014-05-19T22:00:05Z</time></trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="45.3" lon="-122.3"/>
+    </trkseg>
+  </trk>
+</gpx>`
+
+func TestParseGPX(t *testing.T) {
+	geos, err := parseGPX([]byte(testGPX))
+	assert.Equal(t, nil, err)
+
+	testSlicesContainSameGeos(t, []Geo{
+		Geo{
+			Geo: newFeature(newGeometry("Point", newPosition(-122.68, 45.52)), map[string]interface{}{
+				"name": "Esri PDX",
+				"time": "2014-05-19T22:38:53Z",
+				"ele":  15.5,
+			}),
+			Path: []interface{}{"wpt", 0},
+		},
+		Geo{
+			Geo: newFeature(newGeometry("LineString", []interface{}{
+				newPosition(-122.6, 45.5),
+				newPosition(-122.7, 45.6),
+			}), map[string]interface{}{"name": "Route"}),
+			Path: []interface{}{"rte", 0},
+		},
+		Geo{
+			Geo: newFeature(newGeometry("LineString", []interface{}{
+				newPosition(-122.1, 45.1),
+				newPosition(-122.2, 45.2),
+			}), map[string]interface{}{
+				"name":            "Morning",
+				"coordTimes":      []interface{}{"2014-05-19T22:00:00Z", "2014-05-19T22:00:05Z"},
+				"coordElevations": []interface{}{float64(10), float64(11)},
+			}),
+			Path: []interface{}{"trk", 0, "trkseg", 0},
+		},
+		Geo{
+			Geo:  newFeature(newGeometry("Point", newPosition(-122.3, 45.3)), map[string]interface{}{"name": "Morning"}),
+			Path: []interface{}{"trk", 0, "trkseg", 1},
+		},
+	}, geos)
+
+	_, err = parseGPX([]byte(`<gpx><wpt lat="95" lon="0"/></gpx>`))
+	assert.Equal(t, errInvalidGPXPoint, err)
+}
+
+func TestParseGPXMissingLatLon(t *testing.T) {
+	geos, err := parseGPX([]byte(`<gpx>
+  <wpt lat="45.52"><name>no lon</name></wpt>
+  <wpt lon="-122.68"><name>no lat</name></wpt>
+  <wpt lat="45.52" lon="-122.68"/>
+  <trk><trkseg>
+    <trkpt lat="45.1" lon="-122.1"/>
+    <trkpt lon="-122.2"/>
+    <trkpt lat="45.3" lon="-122.3"/>
+  </trkseg><trkseg>
+    <trkpt lat="45.4"/>
+  </trkseg></trk>
+</gpx>`))
+	assert.Equal(t, nil, err)
+
+	testSlicesContainSameGeos(t, []Geo{
+		Geo{
+			Geo:  newFeature(newGeometry("Point", newPosition(-122.68, 45.52)), map[string]interface{}{}),
+			Path: []interface{}{"wpt", 2},
+		},
+		Geo{
+			Geo: newFeature(newGeometry("LineString", []interface{}{
+				newPosition(-122.1, 45.1),
+				newPosition(-122.3, 45.3),
+			}), map[string]interface{}{}),
+			Path: []interface{}{"trk", 0, "trkseg", 0},
+		},
+	}, geos)
+}
+
+func TestGPXRequest(t *testing.T) {
+	// sniffed from the body
+	gr := NewGeobinRequest(0, nil, []byte(testGPX))
+	assert.Equal(t, 4, len(gr.Geo))
+
+	// or found from the content type, when the gpx element is too far in to be sniffed
+	body := []byte("<!-- " + strings.Repeat("exported ", 200) + "-->\n" + testGPX[39:])
+	gr = NewGeobinRequest(0, map[string]string{"Content-Type": "application/gpx+xml; charset=utf-8"}, body)
+	assert.Equal(t, 4, len(gr.Geo))
+
+	gr = NewGeobinRequest(0, map[string]string{"Content-Type": "text/plain"}, body)
+	assert.Equal(t, 0, len(gr.Geo))
+}
@@ -3,18 +3,19 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/go-redis/redis"
 	"github.com/nu7hatch/gouuid"
 )
 
 // createHandler handles requests to /api/1/create. It creates a randomly generated bin_id,
-// creates an entry in redis for it, with a 48 hour expiration time and writes a json object
+// creates an entry in the database for it, with the configured expiration time and writes a json object
 // to the response with the following structure:
 //
 // `{
@@ -22,29 +23,28 @@ import (
 //    "expires": {expiration_timestamp}
 // }`
 //
-// The expiration timestamp is in Unix time (milis).
+// The expiration timestamp is in Unix time (milis). The request body may optionally be a json
+// object with a "ttl" key, holding the number of seconds the bin should live for instead. The
+// requested ttl is limited to the configured maximum.
 func (gb *geobinServer) createHandler(w http.ResponseWriter, r *http.Request) {
 	debugLog("create -", r.URL)
 
-	// Get a new name
-	n, err := gb.randomString(gb.conf.NameLength)
-	if err != nil {
-		log.Println("Failure to create new name:", n, err)
-		http.Error(w, "Could not generate new Geobin!", http.StatusInternalServerError)
+	// Read the optional requested lifetime
+	var opts struct {
+		TTL int64 `json:"ttl"`
+	}
+	if err := decodeOptionalBody(r, &opts); err != nil || opts.TTL < 0 {
+		http.Error(w, "Invalid ttl requested.", http.StatusBadRequest)
 		return
 	}
 
-	// Save to redis
-	if _, err = gb.ZAdd(n, redis.Z{Score: 0, Member: ""}); err != nil {
-		log.Println("Failure to ZADD to", n, err)
-		http.Error(w, "Could not generate new Geobin!", http.StatusInternalServerError)
-		return
+	d := gb.conf.binTTL()
+	if opts.TTL > 0 {
+		d = gb.conf.boundTTL(time.Duration(opts.TTL) * time.Second)
 	}
 
-	// Set expiration
-	d := 48 * time.Hour
-	if _, err = gb.Expire(n, d); err != nil {
-		log.Println("Failure to set EXPIRE for", n, err)
+	n, err := gb.newBin(d)
+	if err != nil {
 		http.Error(w, "Could not generate new Geobin!", http.StatusInternalServerError)
 		return
 	}
@@ -66,6 +66,298 @@ func (gb *geobinServer) createHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// newBin creates a bin with a randomly generated name that expires after d, and returns the name.
+func (gb *geobinServer) newBin(d time.Duration) (string, error) {
+	// Get a new name
+	n, err := gb.randomString(gb.conf.NameLength)
+	if err != nil {
+		log.Println("Failure to create new name:", n, err)
+		return "", err
+	}
+
+	// Save to the db with an expiration
+	if err = gb.CreateBin(n, d); err != nil {
+		log.Println("Failure to create bin", n, err)
+		return "", err
+	}
+	return n, nil
+}
+
+// binsHandler handles requests to /api/1/bins/{bin_id} and /api/1/bins/{bin_id}/{action}. POST
+// and DELETE requests for a bin are handed off to infoHandler and deleteHandler, and POSTs for an
+// action to the handler for the action. It responds with a 404 if there is no such handler.
+func (gb *geobinServer) binsHandler(w http.ResponseWriter, r *http.Request) {
+	debugLog("bins -", r.URL)
+
+	// the path should look like api/1/bins/{bin_id}/{action}, or api/1/bins/{bin_id}
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(path) == 4 {
+		switch r.Method {
+		case "POST":
+			gb.infoHandler(w, r, path[3])
+		case "DELETE":
+			gb.deleteHandler(w, r, path[3])
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+
+	if r.Method != "POST" || len(path) != 5 {
+		http.NotFound(w, r)
+		return
+	}
+
+	name, action := path[3], path[4]
+	switch action {
+	case "expiry":
+		gb.expiryHandler(w, r, name)
+	case "export":
+		gb.exportHandler(w, r, name)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// infoHandler handles POST requests to /api/1/bins/{bin_id}. It writes a json object to the
+// response describing the bin, with the following structure:
+//
+// `{
+//    "id": {bin_id},
+//    "expires": {expiration_timestamp},
+//    "count": {number of requests in the bin},
+//    "dropped": {number of requests dropped from the bin to keep it within its limits}
+// }`
+func (gb *geobinServer) infoHandler(w http.ResponseWriter, r *http.Request, name string) {
+	exists, err := gb.BinExists(name)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	ttl, err := gb.TTL(name)
+	if err != nil {
+		log.Println("Failure to get TTL for", name, err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	count, err := gb.Count(name)
+	if err != nil {
+		log.Println("Failure to get count for", name, err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	dropped, err := gb.Dropped(name)
+	if err != nil {
+		log.Println("Failure to get dropped count for", name, err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      name,
+		"expires": time.Now().Add(ttl).Unix(),
+		"count":   count,
+		"dropped": dropped,
+	}); err != nil {
+		log.Println("Error encoding response:", err)
+		http.Error(w, "Error encoding response!", http.StatusInternalServerError)
+	}
+}
+
+// expiryHandler handles requests to /api/1/bins/{bin_id}/expiry. It changes how long the bin
+// has left before it expires. The request body should be a json object with one of these keys:
+//
+//	"ttl": the number of seconds from now that the bin should expire
+//	"extend": the number of seconds to add to the bin's remaining lifetime
+//
+// Either way, the lifetime is limited to the configured maximum. It writes the bin_id and new
+// expiration timestamp to the response in the same format as createHandler, and lets any open
+// websockets for the bin know about the change.
+func (gb *geobinServer) expiryHandler(w http.ResponseWriter, r *http.Request, name string) {
+	var opts struct {
+		TTL    int64 `json:"ttl"`
+		Extend int64 `json:"extend"`
+	}
+	if err := decodeOptionalBody(r, &opts); err != nil || opts.TTL < 0 || (opts.TTL == 0) == (opts.Extend == 0) {
+		http.Error(w, `Expected a json object with either a positive "ttl" or an "extend".`, http.StatusBadRequest)
+		return
+	}
+
+	d := time.Duration(opts.TTL) * time.Second
+	if opts.Extend != 0 {
+		cur, err := gb.TTL(name)
+		if err == errBinNotFound {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			log.Println("Failure to get TTL for", name, err)
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+
+		d = cur + time.Duration(opts.Extend)*time.Second
+	}
+
+	// a bin shortened to nothing would expire immediately, which is what deleting it is for
+	if d <= 0 {
+		http.Error(w, "The bin's expiry can not be moved into the past.", http.StatusBadRequest)
+		return
+	}
+
+	d = gb.conf.boundTTL(d)
+	if err := gb.Expire(name, d); err == errBinNotFound {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Println("Failure to set expiry for", name, err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	exp := time.Now().Add(d).Unix()
+
+	if err := gb.Publish(name, string(encodeEvent(eventExpiry, map[string]interface{}{
+		"expires": exp,
+	}))); err != nil {
+		log.Println("Failure to PUBLISH to", name, err)
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      name,
+		"expires": exp,
+	}); err != nil {
+		log.Println("Error encoding response:", err)
+		http.Error(w, "Error encoding response!", http.StatusInternalServerError)
+	}
+}
+
+// deleteHandler handles DELETE requests to /api/1/bins/{bin_id}. It deletes the bin and all
+// of the requests in it, then sends a deleted event to the bin's websockets and closes them.
+func (gb *geobinServer) deleteHandler(w http.ResponseWriter, r *http.Request, name string) {
+	if err := gb.DeleteBin(name); err == errBinNotFound {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Println("Failure to delete bin", name, err)
+		http.Error(w, "Could not delete Geobin!", http.StatusInternalServerError)
+		return
+	}
+
+	if err := gb.Publish(name, string(deletedEvent)); err != nil {
+		log.Println("Failure to PUBLISH to", name, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// exportHandler handles requests to /api/1/bins/{bin_id}/export. It writes every request in the
+// bin to the response as JSON Lines, one GeobinRequest per line, oldest first.
+func (gb *geobinServer) exportHandler(w http.ResponseWriter, r *http.Request, name string) {
+	exists, err := gb.BinExists(name)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.jsonl", name))
+
+	// the response has already started by the time most errors could happen, so all we can do
+	// is log them and cut the export short
+	if _, err = writeArchive(w, gb, name); err != nil {
+		log.Println("Failure to export", name, err)
+	}
+}
+
+// importHandler handles requests to /api/1/import. It creates a new bin from a JSON Lines
+// archive in the request body, like the ones written by exportHandler, keeping each request's
+// original timestamp, headers and body. If the "parse" query parameter is "true", the geo data
+// in each request is found again rather than taken from the archive. A "ttl" query parameter
+// may be given in seconds, as with createHandler. It writes a json object to the response with
+// the following structure:
+//
+// `{
+//    "id": {bin_id},
+//    "expires": {expiration_timestamp},
+//    "count": {number of requests imported},
+//    "dropped": {number of those requests dropped to keep the bin within its limits}
+// }`
+func (gb *geobinServer) importHandler(w http.ResponseWriter, r *http.Request) {
+	debugLog("import -", r.URL)
+
+	q := r.URL.Query()
+	d := gb.conf.binTTL()
+	if v := q.Get("ttl"); v != "" {
+		ttl, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || ttl < 0 {
+			http.Error(w, "Invalid ttl requested.", http.StatusBadRequest)
+			return
+		}
+		if ttl > 0 {
+			d = gb.conf.boundTTL(time.Duration(ttl) * time.Second)
+		}
+	}
+
+	if r.Body == nil {
+		http.Error(w, "Missing archive to import.", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// read the whole archive before creating the bin, so that a bad one doesn't leave a half
+	// imported bin behind
+	reqs, err := readArchive(http.MaxBytesReader(w, r.Body, maxArchiveSize), q.Get("parse") == "true")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid archive: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	n, err := gb.newBin(d)
+	if err != nil {
+		http.Error(w, "Could not generate new Geobin!", http.StatusInternalServerError)
+		return
+	}
+
+	var dropped int64
+	for _, gr := range reqs {
+		encoded, err := json.Marshal(gr)
+		if err != nil {
+			log.Println("Error marshalling request:", err)
+			continue
+		}
+
+		trimmed, err := gb.AddRequest(n, gr.Timestamp, string(encoded), gb.conf.retention())
+		if err != nil {
+			log.Println("Failure to add request to", n, err)
+			http.Error(w, fmt.Sprintf("New Geobin created (%v) but we could not import all of the requests!", n), http.StatusInternalServerError)
+			return
+		}
+		dropped += trimmed
+	}
+
+	if err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      n,
+		"expires": time.Now().Add(d).Unix(),
+		"count":   len(reqs),
+		"dropped": dropped,
+	}); err != nil {
+		log.Println("Error encoding response:", err)
+		http.Error(w, "Error encoding response!", http.StatusInternalServerError)
+	}
+}
+
 // countsHandler handles requests to /api/1/counts. It requires an array of binIds as input
 // and responds with a dictionary with the binIds as the key and the number of requests stored
 // in the db for that binId. If a binId is not found in the db, the value for that binId in the
@@ -84,8 +376,8 @@ func (gb *geobinServer) countsHandler(w http.ResponseWriter, r *http.Request) {
 	// look up each binId in db
 	counts := make(map[string]interface{})
 	for _, binId := range binIds {
-		if c, err := gb.ZCount(binId, "-inf", "+inf"); err == nil && c > 0 {
-			counts[binId] = c - 1
+		if c, err := gb.Count(binId); err == nil {
+			counts[binId] = c
 		} else {
 			counts[binId] = nil
 		}
@@ -105,7 +397,7 @@ func (gb *geobinServer) binHandler(w http.ResponseWriter, r *http.Request) {
 	debugLog("bin -", r.URL)
 	name := r.URL.Path[1:]
 
-	exists, err := gb.Exists(name)
+	exists, err := gb.BinExists(name)
 	if err != nil {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
@@ -140,24 +432,37 @@ func (gb *geobinServer) binHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println("Error marshalling request:", err)
 	}
 
-	if _, err = gb.ZAdd(name, redis.Z{Score: float64(time.Now().UTC().Unix()), Member: string(encoded)}); err != nil {
-		log.Println("Failure to ZADD to", name, err)
+	dropped, err := gb.AddRequest(name, gr.Timestamp, string(encoded), gb.conf.retention())
+	if err != nil {
+		log.Println("Failure to add request to", name, err)
 	}
 
-	if _, err = gb.Publish(name, string(encoded)); err != nil {
+	if err = gb.Publish(name, string(encoded)); err != nil {
 		log.Println("Failure to PUBLISH to", name, err)
 	}
+
+	if dropped > 0 {
+		if err = gb.Publish(name, string(encodeEvent(eventDropped, map[string]interface{}{
+			"dropped": dropped,
+		}))); err != nil {
+			log.Println("Failure to PUBLISH to", name, err)
+		}
+	}
 }
 
 // historyHandler handles requests to /api/v1/history/{bin_id}. It requires a bin_id in the
 // request path. It looks said bin_id up in the database and writes all of the GeobinRequests in
-// the database for that bin_id to the response as JSON.
+// the database for that bin_id to the response as JSON. If a "bbox" query parameter of the form
+// minLng,minLat,maxLng,maxLat is given, only the requests with geo data inside it are written.
+//
+// If any of the "limit", "before", "after", "since" or "until" query parameters are given, a
+// single page of the history is written instead, as a historyPage.
 func (gb *geobinServer) historyHandler(w http.ResponseWriter, r *http.Request) {
 	debugLog("history -", r.URL)
 	path := strings.Split(r.URL.Path, "/")
 	name := path[len(path)-1]
 
-	exists, err := gb.Exists(name)
+	exists, err := gb.BinExists(name)
 	if err != nil {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
@@ -168,13 +473,46 @@ func (gb *geobinServer) historyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	set, err := gb.ZRevRange(name, "0", "-1")
-	if err != nil {
-		log.Println("Failure to ZREVRANGE for", name, err)
+	params, paged, perr := parseHistoryParams(r.URL.Query())
+	if perr != nil {
+		http.Error(w, perr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if paged {
+		if r.URL.Query().Get("bbox") != "" {
+			http.Error(w, "The bbox parameter can't be used with paging.", http.StatusBadRequest)
+			return
+		}
+
+		page, err := pageHistory(gb.Store, name, params)
+		if err != nil {
+			log.Println("Failure to get history for", name, err)
+			http.Error(w, "Could not generate history.", http.StatusInternalServerError)
+			return
+		}
+
+		if err = json.NewEncoder(w).Encode(page); err != nil {
+			log.Println("Error marshalling request history:", err)
+			http.Error(w, "Could not generate history.", http.StatusInternalServerError)
+		}
+		return
 	}
 
-	// chop off the last history member since it is the placeholder value from when the set was created
-	vals := set[:len(set)-1]
+	var vals []string
+	if bb := r.URL.Query().Get("bbox"); bb != "" {
+		b, perr := parseBBox(bb)
+		if perr != nil {
+			http.Error(w, perr.Error(), http.StatusBadRequest)
+			return
+		}
+		vals, err = historyWithin(gb.Store, name, b)
+	} else {
+		vals, err = gb.History(name)
+	}
+	if err != nil {
+		log.Println("Failure to get history for", name, err)
+	}
 
 	history := make([]GeobinRequest, 0, len(vals))
 	for _, v := range vals {
@@ -195,9 +533,9 @@ func (gb *geobinServer) historyHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // wsHandler handles requests to /api/1/ws/{bin_id}. It requires a bin_id in the request path
-// and it subscribes to listen for changes to the bin_id in redis. It creates a socket with
-// a UUID and adds that socket to the socketMap. It then sends any updates to the bin_id in
-// redis to the socket as they come in.
+// and it subscribes to listen for changes to the bin_id. It creates a socket with
+// a UUID and adds that socket to the socketMap. It then sends any updates to the bin_id
+// to the socket as they come in.
 func (gb *geobinServer) wsHandler(w http.ResponseWriter, r *http.Request) {
 	debugLog("create -", r.URL)
 	path := strings.Split(r.URL.Path, "/")
@@ -238,3 +576,15 @@ func (gb *geobinServer) wsHandler(w http.ResponseWriter, r *http.Request) {
 	// keep track of the outbound channel for pubsubbery
 	gb.Add(binName, uuid, s)
 }
+
+// decodeOptionalBody decodes the json in the request body into v, if there is any.
+func decodeOptionalBody(r *http.Request, v interface{}) error {
+	if r.Body == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
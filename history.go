@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// how many requests are in a page of history if no limit is asked for, and the most
+	// that can be asked for
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// historyQuery selects part of a bin's history.
+type historyQuery struct {
+	// only the requests received between Since and Until (Unix time, inclusive) are selected
+	Since, Until int64
+	// Oldest selects the oldest requests first, rather than the newest
+	Oldest bool
+	// how many of the selected requests to skip, and the most to return (zero for no limit)
+	Offset, Limit int64
+}
+
+// historyCursor marks a position in a bin's history: the Index'th (counting from zero)
+// of the requests received at Timestamp, in the order they were received.
+type historyCursor struct {
+	Timestamp int64
+	Index     int64
+}
+
+// parseHistoryCursor parses a cursor of the form timestamp-index.
+func parseHistoryCursor(s string) (*historyCursor, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return nil, errors.New("Invalid cursor: " + s)
+	}
+
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || ts < 0 {
+		return nil, errors.New("Invalid cursor: " + s)
+	}
+
+	idx, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || idx < 0 {
+		return nil, errors.New("Invalid cursor: " + s)
+	}
+
+	return &historyCursor{ts, idx}, nil
+}
+
+func (c *historyCursor) String() string {
+	return fmt.Sprintf("%d-%d", c.Timestamp, c.Index)
+}
+
+// historyParams holds the paging parameters accepted by historyHandler.
+type historyParams struct {
+	since, until int64
+	limit        int64
+	// at most one of before and after is set
+	before, after *historyCursor
+}
+
+// parseHistoryParams reads the paging parameters out of a history request's query
+// string. It returns false if there weren't any, in which case the whole history
+// should be returned.
+func parseHistoryParams(v url.Values) (*historyParams, bool, error) {
+	p := &historyParams{
+		since: 0,
+		until: math.MaxInt64,
+		limit: defaultHistoryLimit,
+	}
+
+	paged := false
+	for _, key := range []string{"limit", "before", "after", "since", "until"} {
+		s := v.Get(key)
+		if s == "" {
+			continue
+		}
+		paged = true
+
+		var err error
+		switch key {
+		case "limit":
+			p.limit, err = strconv.ParseInt(s, 10, 64)
+			if err == nil && p.limit < 1 {
+				err = errors.New("limit must be positive")
+			}
+			if p.limit > maxHistoryLimit {
+				p.limit = maxHistoryLimit
+			}
+		case "before":
+			p.before, err = parseHistoryCursor(s)
+		case "after":
+			p.after, err = parseHistoryCursor(s)
+		case "since":
+			p.since, err = strconv.ParseInt(s, 10, 64)
+		case "until":
+			p.until, err = strconv.ParseInt(s, 10, 64)
+		}
+
+		if err != nil {
+			return nil, false, errors.New("Invalid " + key + ": " + err.Error())
+		}
+	}
+
+	if p.before != nil && p.after != nil {
+		return nil, false, errors.New("Only one of before and after can be given.")
+	}
+
+	return p, paged, nil
+}
+
+// historyPage is one page of a bin's history, as written out by historyHandler.
+type historyPage struct {
+	// the requests on this page, newest first
+	Requests []*GeobinRequest `json:"requests"`
+	// the number of requests received between since and until, on every page
+	Total int64 `json:"total"`
+	// where the next page starts, if there is one
+	Next string `json:"next,omitempty"`
+}
+
+// pageHistory returns the page of a bin's history described by p. Pages run from newest
+// to oldest, unless they're asked for with an after cursor, in which case they run
+// towards the newest requests instead. Either way the requests on each page are newest first.
+func pageHistory(st Store, name string, p *historyParams) (*historyPage, error) {
+	total, err := st.CountRange(name, p.since, p.until)
+	if err != nil {
+		return nil, err
+	}
+
+	// one extra request is asked for to find out if there's another page after this one
+	q := historyQuery{Since: p.since, Until: p.until, Limit: p.limit + 1}
+
+	// the cursor the page starts from, if it falls inside since and until
+	var from *historyCursor
+	if c := p.after; c != nil {
+		q.Oldest = true
+		if c.Timestamp >= q.Since {
+			q.Since = c.Timestamp
+			q.Offset = c.Index + 1
+			from = c
+		}
+	} else if c := p.before; c != nil && c.Timestamp <= q.Until {
+		q.Until = c.Timestamp
+		// skip over the requests received at the same time as the cursor that aren't older than it
+		n, err := st.CountRange(name, c.Timestamp, c.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		if q.Offset = n - c.Index; q.Offset < 0 {
+			q.Offset = 0
+		}
+		from = c
+	}
+
+	vals, err := st.HistoryRange(name, q)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &historyPage{
+		Requests: make([]*GeobinRequest, 0, len(vals)),
+		Total:    total,
+	}
+	for _, v := range vals {
+		gr := &GeobinRequest{}
+		if err := json.Unmarshal([]byte(v), gr); err != nil {
+			log.Println("Error unmarshalling request history:", err)
+		}
+		page.Requests = append(page.Requests, gr)
+	}
+
+	if int64(len(page.Requests)) > p.limit {
+		page.Requests = page.Requests[:p.limit]
+		next, err := nextHistoryCursor(st, name, page.Requests, q, from)
+		if err != nil {
+			return nil, err
+		}
+		page.Next = next.String()
+	}
+
+	if q.Oldest {
+		for i, j := 0, len(page.Requests)-1; i < j; i, j = i+1, j-1 {
+			page.Requests[i], page.Requests[j] = page.Requests[j], page.Requests[i]
+		}
+	}
+
+	return page, nil
+}
+
+// nextHistoryCursor returns the cursor for the last of the requests selected by q,
+// which started from the cursor from (or nil if it started from since or until).
+func nextHistoryCursor(st Store, name string, reqs []*GeobinRequest, q historyQuery, from *historyCursor) (*historyCursor, error) {
+	ts := reqs[len(reqs)-1].Timestamp
+
+	// how many of the requests received at ts are on this page, and how many were skipped
+	var onPage, skipped int64
+	for _, gr := range reqs {
+		if gr.Timestamp == ts {
+			onPage++
+		}
+	}
+	if from != nil && from.Timestamp == ts {
+		skipped = q.Offset
+	}
+
+	if q.Oldest {
+		return &historyCursor{ts, skipped + onPage - 1}, nil
+	}
+
+	// going backwards, the index has to be counted from the other end
+	n, err := st.CountRange(name, ts, ts)
+	if err != nil {
+		return nil, err
+	}
+	idx := n - skipped - onPage
+	if idx < 0 {
+		// requests were deleted out from under us
+		idx = 0
+	}
+	return &historyCursor{ts, idx}, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestParseHistoryParams(t *testing.T) {
+	_, paged, err := parseHistoryParams(url.Values{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, paged)
+
+	p, paged, err := parseHistoryParams(url.Values{"limit": {"5000"}, "before": {"1400539133-2"}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, paged)
+	assert.Equal(t, int64(maxHistoryLimit), p.limit)
+	assert.Equal(t, &historyCursor{1400539133, 2}, p.before)
+
+	for _, v := range []url.Values{
+		{"limit": {"0"}},
+		{"since": {"yesterday"}},
+		{"before": {"1400539133"}},
+		{"after": {"1400539133--1"}},
+		{"before": {"1-0"}, "after": {"1-0"}},
+	} {
+		_, _, err = parseHistoryParams(v)
+		assert.NotEqual(t, nil, err)
+	}
+}
+
+func TestPageHistoryMemoryStore(t *testing.T) {
+	testPageHistory(t, NewMemoryStore())
+}
+
+func TestPageHistoryBoltStore(t *testing.T) {
+	path, cleanup := tempDBPath(t)
+	defer cleanup()
+
+	bs, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bs.Close()
+
+	testPageHistory(t, bs)
+}
+
+func TestPageHistorySQLiteStore(t *testing.T) {
+	path, cleanup := tempDBPath(t)
+	defer cleanup()
+
+	ss, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	testPageHistory(t, ss)
+}
+
+// testPageHistory pages back and forth through a bin with several requests received in
+// the same second.
+func testPageHistory(t *testing.T, st Store) {
+	assert.Equal(t, nil, st.CreateBin("bin_name", time.Hour))
+	for _, r := range []struct {
+		ts   int64
+		body string
+	}{{1, "a"}, {2, "b1"}, {2, "b2"}, {2, "b3"}, {3, "c"}} {
+		encoded, err := json.Marshal(&GeobinRequest{Timestamp: r.ts, Body: r.body})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, nil, addRequest(st, "bin_name", r.ts, string(encoded)))
+	}
+
+	page := func(p *historyParams) ([]string, string) {
+		p.limit = 2
+		if p.until == 0 {
+			p.until = 10
+		}
+
+		hp, err := pageHistory(st, "bin_name", p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bodies := make([]string, 0)
+		for _, gr := range hp.Requests {
+			bodies = append(bodies, gr.Body)
+		}
+		return bodies, hp.Next
+	}
+
+	bodies, next := page(&historyParams{})
+	assert.Equal(t, []string{"c", "b3"}, bodies)
+	assert.Equal(t, "2-2", next)
+
+	bodies, next = page(&historyParams{before: &historyCursor{2, 2}})
+	assert.Equal(t, []string{"b2", "b1"}, bodies)
+	assert.Equal(t, "2-0", next)
+
+	bodies, next = page(&historyParams{before: &historyCursor{2, 0}})
+	assert.Equal(t, []string{"a"}, bodies)
+	assert.Equal(t, "", next)
+
+	// after pages head towards the newest requests, but are still newest first
+	bodies, next = page(&historyParams{after: &historyCursor{2, 0}})
+	assert.Equal(t, []string{"b3", "b2"}, bodies)
+	assert.Equal(t, "2-2", next)
+
+	bodies, next = page(&historyParams{after: &historyCursor{2, 2}})
+	assert.Equal(t, []string{"c"}, bodies)
+	assert.Equal(t, "", next)
+
+	// since and until limit both the requests and the total
+	hp, err := pageHistory(st, "bin_name", &historyParams{since: 2, until: 2, limit: 10})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(3), hp.Total)
+	assert.Equal(t, 3, len(hp.Requests))
+
+	bodies, next = page(&historyParams{since: 3, before: &historyCursor{2, 2}})
+	assert.Equal(t, []string{}, bodies)
+	assert.Equal(t, "", next)
+}
+
+func TestHistoryHandlerPaged(t *testing.T) {
+	be := newMemoryBackend()
+	gbs := NewGeobinServer(testConf, be.Store, be.PubSubber, NewSocketMap(be.PubSubber))
+	bins, _ := createBins(gbs, []int{3}, t)
+
+	history := func(query string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "http://testing.geobin.io/api/1/history/"+bins[0]+query, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		w := httptest.NewRecorder()
+		gbs.ServeHTTP(w, req)
+		return w
+	}
+
+	w := history("?limit=2")
+	assertResponseOK(w, t)
+	var page historyPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, int64(3), page.Total)
+	assert.Equal(t, 2, len(page.Requests))
+	assert.NotEqual(t, "", page.Next)
+
+	w = history("?limit=2&before=" + page.Next)
+	assertResponseOK(w, t)
+	page = historyPage{}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, 1, len(page.Requests))
+	assert.Equal(t, "", page.Next)
+
+	assertResponseCode(history("?limit=-1"), http.StatusBadRequest, t)
+	assertResponseCode(history("?limit=2&bbox=-1,-1,1,1"), http.StatusBadRequest, t)
+}
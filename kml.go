@@ -0,0 +1,257 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxKMLSize is the most a KML document in a KMZ archive can be uncompressed, in bytes.
+const maxKMLSize = 16 << 20
+
+var (
+	errInvalidKMLCoordinates = errors.New("invalid KML coordinates")
+	errNoKML                 = errors.New("no KML document in KMZ archive")
+)
+
+// kmlDoc holds the parts of a KML document that we turn into geo data.
+type kmlDoc struct {
+	XMLName xml.Name `xml:"kml"`
+	kmlContainer
+}
+
+// kmlContainer is a Document or Folder, or the kml element itself.
+type kmlContainer struct {
+	Documents  []kmlContainer `xml:"Document"`
+	Folders    []kmlContainer `xml:"Folder"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name        string `xml:"name"`
+	Description string `xml:"description"`
+	kmlGeometries
+}
+
+// kmlGeometries are the geometries in a Placemark or MultiGeometry.
+type kmlGeometries struct {
+	Points          []kmlCoordinates `xml:"Point"`
+	LineStrings     []kmlCoordinates `xml:"LineString"`
+	LinearRings     []kmlCoordinates `xml:"LinearRing"`
+	Polygons        []kmlPolygon     `xml:"Polygon"`
+	MultiGeometries []kmlGeometries  `xml:"MultiGeometry"`
+}
+
+type kmlCoordinates struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlPolygon struct {
+	Outer kmlCoordinates   `xml:"outerBoundaryIs>LinearRing"`
+	Inner []kmlCoordinates `xml:"innerBoundaryIs>LinearRing"`
+}
+
+func sniffKML(body []byte) bool {
+	return sniffXML(body, "kml")
+}
+
+// sniffKMZ checks for the signature at the start of a zip archive.
+func sniffKMZ(body []byte) bool {
+	return bytes.HasPrefix(body, []byte("PK\x03\x04"))
+}
+
+// parseKML finds the Placemarks in a KML document. Each one becomes a Feature, with its name and
+// description as properties. A Placemark with more than one geometry, or a MultiGeometry, becomes
+// a GeometryCollection. The path of each Placemark is made up of the Documents and Folders it is
+// in and its place among their Placemarks, such as ["Document", 0, "Folder", 2, "Placemark", 1].
+func parseKML(body []byte) ([]Geo, error) {
+	var doc kmlDoc
+	if err := xml.NewDecoder(bytes.NewReader(body)).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	geos := make([]Geo, 0)
+	if err := doc.appendGeos(&geos, make([]interface{}, 0)); err != nil {
+		return nil, err
+	}
+	return geos, nil
+}
+
+// parseKMZ finds the KML document in a KMZ archive and parses it with parseKML. Google Earth
+// names it doc.kml, but any .kml file at the top of the archive will do.
+func parseKMZ(body []byte) ([]Geo, error) {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+
+	var kml *zip.File
+	for _, f := range zr.File {
+		if f.Name == "doc.kml" {
+			kml = f
+			break
+		}
+		if kml == nil && !strings.Contains(f.Name, "/") && strings.EqualFold(path.Ext(f.Name), ".kml") {
+			kml = f
+		}
+	}
+	if kml == nil {
+		return nil, errNoKML
+	}
+
+	rc, err := kml.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(&io.LimitedReader{R: rc, N: maxKMLSize + 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxKMLSize {
+		return nil, errors.New("KML document in KMZ archive is too big")
+	}
+	return parseKML(b)
+}
+
+// appendGeos appends the Placemarks in the container, and in the containers within it, to geos.
+func (c *kmlContainer) appendGeos(geos *[]Geo, kp []interface{}) error {
+	for i := range c.Documents {
+		if err := c.Documents[i].appendGeos(geos, appendPath(kp, "Document", i)); err != nil {
+			return err
+		}
+	}
+
+	for i := range c.Folders {
+		if err := c.Folders[i].appendGeos(geos, appendPath(kp, "Folder", i)); err != nil {
+			return err
+		}
+	}
+
+	for i, p := range c.Placemarks {
+		gs, err := p.geometries()
+		if err != nil {
+			return err
+		}
+
+		var geometry map[string]interface{}
+		switch len(gs) {
+		case 0:
+			continue
+		case 1:
+			geometry = gs[0].(map[string]interface{})
+		default:
+			geometry = map[string]interface{}{"type": "GeometryCollection", "geometries": gs}
+		}
+
+		props := make(map[string]interface{})
+		if name := strings.TrimSpace(p.Name); name != "" {
+			props["name"] = name
+		}
+		if desc := strings.TrimSpace(p.Description); desc != "" {
+			props["description"] = desc
+		}
+
+		*geos = append(*geos, Geo{
+			Geo:  newFeature(geometry, props),
+			Path: appendPath(kp, "Placemark", i),
+		})
+	}
+	return nil
+}
+
+// geometries converts the KML geometries to GeoJSON geometries.
+func (g *kmlGeometries) geometries() ([]interface{}, error) {
+	gs := make([]interface{}, 0)
+	for _, p := range g.Points {
+		coords, err := parseKMLCoordinates(p.Coordinates)
+		if err != nil {
+			return nil, err
+		}
+		if len(coords) != 1 {
+			return nil, errInvalidKMLCoordinates
+		}
+		gs = append(gs, newGeometry("Point", coords[0]))
+	}
+
+	for _, l := range g.LineStrings {
+		coords, err := parseKMLCoordinates(l.Coordinates)
+		if err != nil {
+			return nil, err
+		}
+		gs = append(gs, newGeometry("LineString", coords))
+	}
+
+	for _, r := range g.LinearRings {
+		coords, err := parseKMLCoordinates(r.Coordinates)
+		if err != nil {
+			return nil, err
+		}
+		gs = append(gs, newGeometry("Polygon", []interface{}{coords}))
+	}
+
+	for _, p := range g.Polygons {
+		outer, err := parseKMLCoordinates(p.Outer.Coordinates)
+		if err != nil {
+			return nil, err
+		}
+
+		rings := []interface{}{outer}
+		for _, in := range p.Inner {
+			inner, err := parseKMLCoordinates(in.Coordinates)
+			if err != nil {
+				return nil, err
+			}
+			rings = append(rings, inner)
+		}
+		gs = append(gs, newGeometry("Polygon", rings))
+	}
+
+	for _, mg := range g.MultiGeometries {
+		members, err := mg.geometries()
+		if err != nil {
+			return nil, err
+		}
+		gs = append(gs, map[string]interface{}{"type": "GeometryCollection", "geometries": members})
+	}
+	return gs, nil
+}
+
+// parseKMLCoordinates parses the contents of a KML coordinates element, which is a whitespace
+// separated list of lng,lat or lng,lat,alt tuples. Altitudes are kept as a third coordinate.
+func parseKMLCoordinates(s string) ([]interface{}, error) {
+	tuples := strings.Fields(s)
+	if len(tuples) == 0 {
+		return nil, errInvalidKMLCoordinates
+	}
+
+	coords := make([]interface{}, len(tuples))
+	for i, t := range tuples {
+		vals := strings.Split(t, ",")
+		if len(vals) < 2 || len(vals) > 3 {
+			return nil, errInvalidKMLCoordinates
+		}
+
+		pos := make([]interface{}, len(vals))
+		for j, v := range vals {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, errInvalidKMLCoordinates
+			}
+			pos[j] = f
+		}
+
+		if !lngIsValid(pos[0].(float64)) || !latIsValid(pos[1].(float64)) {
+			return nil, errInvalidKMLCoordinates
+		}
+		coords[i] = pos
+	}
+	return coords, nil
+}
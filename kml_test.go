@@ -0,0 +1,117 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+const testKML = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+  <Document>
+    <name>Portland</name>
+    <Placemark>
+      <name>Esri PDX</name>
+      <description>Office</description>
+      <Point><coordinates>-122.68,45.52,0</coordinates></Point>
+    </Placemark>
+    <Folder>
+      <name>Empty</name>
+    </Folder>
+    <Folder>
+      <name>Parks</name>
+      <Placemark>
+        <name>Park</name>
+        <Polygon>
+          <outerBoundaryIs><LinearRing><coordinates>
+            0,0 10,0 10,10 0,10 0,0
+          </coordinates></LinearRing></outerBoundaryIs>
+          <innerBoundaryIs><LinearRing><coordinates>1,1 2,1 2,2 1,1</coordinates></LinearRing></innerBoundaryIs>
+        </Polygon>
+      </Placemark>
+      <Placemark>
+        <MultiGeometry>
+          <Point><coordinates>1,2</coordinates></Point>
+          <LineString><coordinates>1,2 3,4</coordinates></LineString>
+        </MultiGeometry>
+      </Placemark>
+    </Folder>
+  </Document>
+</kml>`
+
+func TestParseKML(t *testing.T) {
+	geos, err := parseKML([]byte(testKML))
+	assert.Equal(t, nil, err)
+
+	testSlicesContainSameGeos(t, []Geo{
+		Geo{
+			Geo: newFeature(newGeometry("Point", []interface{}{-122.68, 45.52, float64(0)}), map[string]interface{}{
+				"name":        "Esri PDX",
+				"description": "Office",
+			}),
+			Path: []interface{}{"Document", 0, "Placemark", 0},
+		},
+		Geo{
+			Geo: newFeature(newGeometry("Polygon", []interface{}{
+				[]interface{}{
+					newPosition(0, 0), newPosition(10, 0), newPosition(10, 10), newPosition(0, 10), newPosition(0, 0),
+				},
+				[]interface{}{
+					newPosition(1, 1), newPosition(2, 1), newPosition(2, 2), newPosition(1, 1),
+				},
+			}), map[string]interface{}{"name": "Park"}),
+			Path: []interface{}{"Document", 0, "Folder", 1, "Placemark", 0},
+		},
+		Geo{
+			Geo: newFeature(map[string]interface{}{
+				"type": "GeometryCollection",
+				"geometries": []interface{}{
+					newGeometry("Point", newPosition(1, 2)),
+					newGeometry("LineString", []interface{}{newPosition(1, 2), newPosition(3, 4)}),
+				},
+			}, nil),
+			Path: []interface{}{"Document", 0, "Folder", 1, "Placemark", 1},
+		},
+	}, geos)
+
+	for _, c := range []string{"", "1", "1,2,3,4", "200,0", "a,b"} {
+		_, err = parseKML([]byte(`<kml><Placemark><Point><coordinates>` + c + `</coordinates></Point></Placemark></kml>`))
+		assert.Equal(t, errInvalidKMLCoordinates, err, c)
+	}
+}
+
+func TestKMZRequest(t *testing.T) {
+	kmz := func(name string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.Create("files/icon.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("not really a png"))
+
+		if w, err = zw.Create(name); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(testKML))
+
+		if err = zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	gr := NewGeobinRequest(0, nil, kmz("doc.kml"))
+	assert.Equal(t, 3, len(gr.Geo))
+
+	gr = NewGeobinRequest(0, map[string]string{"Content-Type": "application/vnd.google-earth.kmz"}, kmz("Portland.KML"))
+	assert.Equal(t, 3, len(gr.Geo))
+
+	_, err := parseKMZ(kmz("files/doc.kml"))
+	assert.Equal(t, errNoKML, err)
+
+	gr = NewGeobinRequest(0, nil, []byte(testKML))
+	assert.Equal(t, 3, len(gr.Geo))
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// how often the memory store sweeps out expired bins and counters
+const memorySweepInterval = time.Minute
+
+// memoryStore is a Store that keeps everything in process memory. Nothing survives
+// a restart, which makes it a good fit for development and testing.
+type memoryStore struct {
+	*memoryCounters
+	lk   sync.Mutex
+	bins map[string]*memoryBin
+}
+
+type memoryBin struct {
+	expires time.Time
+	// requests are kept in the order they were received
+	requests []memoryRequest
+	// the total size of the encoded requests, and how many have been dropped
+	bytes   int64
+	dropped int64
+}
+
+type memoryRequest struct {
+	ts      int64
+	encoded string
+}
+
+// NewMemoryStore creates an empty Store that lives in process memory.
+func NewMemoryStore() Store {
+	ms := &memoryStore{
+		memoryCounters: newMemoryCounters(),
+		bins:           make(map[string]*memoryBin),
+	}
+
+	go ms.sweep(memorySweepInterval)
+	return ms
+}
+
+func (ms *memoryStore) CreateBin(name string, ttl time.Duration) error {
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+
+	if ms.bin(name) != nil {
+		return errors.New("A bin by that id already exists.")
+	}
+
+	ms.bins[name] = &memoryBin{
+		expires:  time.Now().Add(ttl),
+		requests: make([]memoryRequest, 0),
+	}
+	return nil
+}
+
+func (ms *memoryStore) BinExists(name string) (bool, error) {
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+
+	return ms.bin(name) != nil, nil
+}
+
+func (ms *memoryStore) AddRequest(name string, ts int64, encoded string, r retention) (int64, error) {
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+
+	b := ms.bin(name)
+	if b == nil {
+		return 0, errBinNotFound
+	}
+
+	// keep the requests sorted by timestamp, just like a redis sorted set would
+	i := sort.Search(len(b.requests), func(i int) bool {
+		return b.requests[i].ts > ts
+	})
+	b.requests = append(b.requests, memoryRequest{})
+	copy(b.requests[i+1:], b.requests[i:])
+	b.requests[i] = memoryRequest{ts, encoded}
+	b.bytes += int64(len(encoded))
+
+	var dropped int64
+	for r.exceeded(int64(len(b.requests)), b.bytes) {
+		b.bytes -= int64(len(b.requests[0].encoded))
+		b.requests = b.requests[1:]
+		dropped++
+	}
+	b.dropped += dropped
+	return dropped, nil
+}
+
+func (ms *memoryStore) History(name string) ([]string, error) {
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+
+	b := ms.bin(name)
+	if b == nil {
+		return nil, errBinNotFound
+	}
+
+	history := make([]string, len(b.requests))
+	for i, r := range b.requests {
+		history[len(history)-1-i] = r.encoded
+	}
+	return history, nil
+}
+
+func (ms *memoryStore) HistoryRange(name string, q historyQuery) ([]string, error) {
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+
+	b := ms.bin(name)
+	if b == nil {
+		return nil, errBinNotFound
+	}
+
+	selected := b.between(q.Since, q.Until)
+	history := make([]string, 0)
+	for i := q.Offset; i < int64(len(selected)); i++ {
+		if q.Limit > 0 && int64(len(history)) == q.Limit {
+			break
+		}
+
+		if q.Oldest {
+			history = append(history, selected[i].encoded)
+		} else {
+			history = append(history, selected[int64(len(selected))-1-i].encoded)
+		}
+	}
+	return history, nil
+}
+
+func (ms *memoryStore) Count(name string) (int64, error) {
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+
+	b := ms.bin(name)
+	if b == nil {
+		return 0, errBinNotFound
+	}
+
+	return int64(len(b.requests)), nil
+}
+
+func (ms *memoryStore) CountRange(name string, since, until int64) (int64, error) {
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+
+	b := ms.bin(name)
+	if b == nil {
+		return 0, errBinNotFound
+	}
+
+	return int64(len(b.between(since, until))), nil
+}
+
+func (ms *memoryStore) Dropped(name string) (int64, error) {
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+
+	b := ms.bin(name)
+	if b == nil {
+		return 0, errBinNotFound
+	}
+
+	return b.dropped, nil
+}
+
+func (ms *memoryStore) Expire(name string, ttl time.Duration) error {
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+
+	b := ms.bin(name)
+	if b == nil {
+		return errBinNotFound
+	}
+
+	b.expires = time.Now().Add(ttl)
+	return nil
+}
+
+func (ms *memoryStore) TTL(name string) (time.Duration, error) {
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+
+	b := ms.bin(name)
+	if b == nil {
+		return 0, errBinNotFound
+	}
+
+	return b.expires.Sub(time.Now()), nil
+}
+
+func (ms *memoryStore) DeleteBin(name string) error {
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+
+	if ms.bin(name) == nil {
+		return errBinNotFound
+	}
+
+	delete(ms.bins, name)
+	return nil
+}
+
+// between returns the requests in the bin received between since and until (inclusive),
+// oldest first.
+func (b *memoryBin) between(since, until int64) []memoryRequest {
+	lo := sort.Search(len(b.requests), func(i int) bool {
+		return b.requests[i].ts >= since
+	})
+	hi := sort.Search(len(b.requests), func(i int) bool {
+		return b.requests[i].ts > until
+	})
+
+	if hi < lo {
+		return nil
+	}
+	return b.requests[lo:hi]
+}
+
+// bin returns the named bin, or nil if it doesn't exist or has expired.
+// The caller must hold ms.lk.
+func (ms *memoryStore) bin(name string) *memoryBin {
+	b, ok := ms.bins[name]
+	if !ok {
+		return nil
+	}
+
+	if time.Now().After(b.expires) {
+		delete(ms.bins, name)
+		return nil
+	}
+
+	return b
+}
+
+// sweep periodically removes expired bins and counters so they don't accumulate
+// in memory when nobody asks for them again.
+func (ms *memoryStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		ms.lk.Lock()
+		for name, b := range ms.bins {
+			if now.After(b.expires) {
+				delete(ms.bins, name)
+			}
+		}
+		ms.lk.Unlock()
+
+		ms.memoryCounters.sweep(now)
+	}
+}
+
+// memoryCounters implements Store.Incr in process memory. Counters are only used
+// for short lived things like rate limiting, so the other stores use them too.
+type memoryCounters struct {
+	lk       sync.Mutex
+	counters map[string]*memoryCounter
+}
+
+type memoryCounter struct {
+	expires time.Time
+	n       int64
+}
+
+func newMemoryCounters() *memoryCounters {
+	return &memoryCounters{
+		counters: make(map[string]*memoryCounter),
+	}
+}
+
+func (mc *memoryCounters) Incr(key string, ttl time.Duration) (int64, error) {
+	mc.lk.Lock()
+	defer mc.lk.Unlock()
+
+	c, ok := mc.counters[key]
+	if !ok || time.Now().After(c.expires) {
+		c = &memoryCounter{expires: time.Now().Add(ttl)}
+		mc.counters[key] = c
+	}
+
+	c.n++
+	return c.n, nil
+}
+
+// sweep removes all of the counters that expired before now.
+func (mc *memoryCounters) sweep(now time.Time) {
+	mc.lk.Lock()
+	defer mc.lk.Unlock()
+
+	for key, c := range mc.counters {
+		if now.After(c.expires) {
+			delete(mc.counters, key)
+		}
+	}
+}
+
+// memoryPubSub is a PubSubber that delivers published messages within the process.
+// Messages are only queued for channels that have been subscribed to.
+type memoryPubSub struct {
+	lk   sync.Mutex
+	subs map[string]bool
+	msgs chan memoryMessage
+}
+
+type memoryMessage struct {
+	channel string
+	payload string
+}
+
+// NewMemoryPubSub creates an in-process PubSubber. Use memoryPump to deliver the
+// messages published through it.
+func NewMemoryPubSub() *memoryPubSub {
+	return &memoryPubSub{
+		subs: make(map[string]bool),
+		msgs: make(chan memoryMessage, 256),
+	}
+}
+
+func (mps *memoryPubSub) Subscribe(channels ...string) error {
+	mps.lk.Lock()
+	defer mps.lk.Unlock()
+	for _, c := range channels {
+		mps.subs[c] = true
+	}
+	return nil
+}
+
+func (mps *memoryPubSub) Unsubscribe(channels ...string) error {
+	mps.lk.Lock()
+	defer mps.lk.Unlock()
+	for _, c := range channels {
+		delete(mps.subs, c)
+	}
+	return nil
+}
+
+func (mps *memoryPubSub) Publish(channel, message string) error {
+	mps.lk.Lock()
+	subscribed := mps.subs[channel]
+	mps.lk.Unlock()
+
+	if subscribed {
+		mps.msgs <- memoryMessage{channel, message}
+	}
+	return nil
+}
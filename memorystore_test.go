@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestMemoryStoreBins(t *testing.T) {
+	ms := NewMemoryStore()
+
+	exists, err := ms.BinExists("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, exists)
+	assert.Equal(t, errBinNotFound, addRequest(ms, "bin_name", 1, "one"))
+
+	assert.Equal(t, nil, ms.CreateBin("bin_name", time.Hour))
+	assert.NotEqual(t, nil, ms.CreateBin("bin_name", time.Hour))
+	exists, err = ms.BinExists("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, exists)
+
+	history, err := ms.History("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{}, history)
+
+	// requests should come back newest first, regardless of the order they were added in
+	assert.Equal(t, nil, addRequest(ms, "bin_name", 2, "two"))
+	assert.Equal(t, nil, addRequest(ms, "bin_name", 1, "one"))
+	assert.Equal(t, nil, addRequest(ms, "bin_name", 3, "three"))
+
+	history, err = ms.History("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"three", "two", "one"}, history)
+
+	count, err := ms.Count("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(3), count)
+
+	_, err = ms.Count("unknown_bin_name")
+	assert.Equal(t, errBinNotFound, err)
+
+	assert.Equal(t, nil, ms.DeleteBin("bin_name"))
+	assert.Equal(t, errBinNotFound, ms.DeleteBin("bin_name"))
+	exists, err = ms.BinExists("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, exists)
+}
+
+func TestMemoryStoreExpire(t *testing.T) {
+	ms := NewMemoryStore()
+	assert.Equal(t, nil, ms.CreateBin("bin_name", time.Hour))
+	assert.Equal(t, nil, ms.Expire("bin_name", -time.Second))
+
+	exists, err := ms.BinExists("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, exists)
+	assert.Equal(t, errBinNotFound, ms.Expire("bin_name", time.Hour))
+}
+
+func TestMemoryStoreIncr(t *testing.T) {
+	ms := NewMemoryStore()
+
+	n, err := ms.Incr("counter", time.Hour)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(1), n)
+	n, err = ms.Incr("counter", time.Hour)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(2), n)
+
+	// an expired counter starts over
+	n, err = ms.Incr("expired", -time.Second)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(1), n)
+	n, err = ms.Incr("expired", -time.Second)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestMemoryPubSub(t *testing.T) {
+	mps := NewMemoryPubSub()
+	sm := NewSocketMap(mps)
+	go memoryPump(mps, sm)
+
+	ms := &MockSocket{name: "mock_socket"}
+	sm.Add("bin_name", "socket_uuid", ms)
+
+	// nobody has subscribed yet, so this should be dropped
+	assert.Equal(t, nil, mps.Publish("bin_name", "a message"))
+	time.Sleep(25 * time.Millisecond)
+	assert.Equal(t, false, ms.getDidWrite())
+
+	assert.Equal(t, nil, mps.Subscribe("bin_name"))
+	assert.Equal(t, nil, mps.Publish("bin_name", "a message"))
+	time.Sleep(25 * time.Millisecond)
+	assert.Equal(t, true, ms.getDidWrite())
+}
+
+func TestMemoryBackendServer(t *testing.T) {
+	be := newMemoryBackend()
+	gbs := NewGeobinServer(testConf, be, be, NewSocketMap(be))
+	bins, expected := createBins(gbs, []int{0, 3}, t)
+	verifyCounts(gbs, bins, expected, t)
+
+	req, err := http.NewRequest("POST", "http://testing.geobin.io/api/1/history/"+bins[1], nil)
+	if err != nil {
+		t.Error(err)
+	}
+	w := httptest.NewRecorder()
+	gbs.ServeHTTP(w, req)
+	assertResponseOK(w, t)
+
+	var history []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, 3, len(history))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// mgrsPattern matches an MGRS grid reference: a UTM zone and latitude band, the letters of a
+// 100km square, and an even number of digits, half easting and half northing. Spaces may be put
+// between the parts. A bare 100km square, with no digits, isn't matched, as short strings like
+// "10MAD" are far more often something else.
+var mgrsPattern = regexp.MustCompile(`^(\d{1,2})([C-HJ-NP-X]) ?([A-HJ-NP-Z])([A-HJ-NP-V]) ?(\d+) ?(\d*)$`)
+
+// mgrsColumnLetters are the letters of the columns of 100km squares, which start over every
+// third zone. The first column in each zone is 100km east of its origin.
+var mgrsColumnLetters = [3]string{"ABCDEFGH", "JKLMNPQR", "STUVWXYZ"}
+
+// mgrsRowLetters are the letters of the rows of 100km squares, which repeat every 2000km north.
+// Even numbered zones start five letters in.
+const mgrsRowLetters = "ABCDEFGHJKLMNPQRSTUV"
+
+// mgrsBandNorthings are the lowest northings, rounded down to 100km, in each latitude band. They
+// say which of the 2000km cycles of row letters a grid reference is in.
+var mgrsBandNorthings = map[byte]float64{
+	'C': 1100000, 'D': 2000000, 'E': 2800000, 'F': 3700000, 'G': 4600000,
+	'H': 5500000, 'J': 6400000, 'K': 7300000, 'L': 8200000, 'M': 9100000,
+	'N': 0, 'P': 800000, 'Q': 1700000, 'R': 2600000, 'S': 3500000,
+	'T': 4400000, 'U': 5300000, 'V': 6200000, 'W': 7000000, 'X': 7900000,
+}
+
+var errNotMGRS = errors.New("not an MGRS grid reference")
+
+// parseMGRS decodes an MGRS grid reference, such as "18SUJ2337106519", at any precision from a
+// 100km square down to a 1m one. It returns the Polygon of the square the reference stands for
+// and the Point at its center, as Features with the grid reference and its precision in meters
+// as properties. The polar regions, which MGRS covers with UPS instead of UTM, aren't supported.
+func parseMGRS(s string, kp []interface{}) ([]Geo, error) {
+	ref := strings.ToUpper(strings.TrimSpace(s))
+	m := mgrsPattern.FindStringSubmatch(ref)
+	if m == nil {
+		return nil, errNotMGRS
+	}
+
+	// without a space between them, the first half of the digits are the easting
+	if m[6] == "" {
+		if len(m[5])%2 != 0 {
+			return nil, errNotMGRS
+		}
+		m[5], m[6] = m[5][:len(m[5])/2], m[5][len(m[5])/2:]
+	}
+	if len(m[5]) != len(m[6]) || len(m[5]) > 5 {
+		return nil, errNotMGRS
+	}
+
+	zone, _ := strconv.Atoi(m[1])
+	if zone < 1 || zone > 60 {
+		return nil, errNotMGRS
+	}
+	band := m[2][0]
+
+	col := strings.Index(mgrsColumnLetters[(zone-1)%3], m[3])
+	row := strings.Index(mgrsRowLetters, m[4])
+	if col < 0 {
+		return nil, errNotMGRS
+	}
+	if zone%2 == 0 {
+		row = (row + len(mgrsRowLetters) - 5) % len(mgrsRowLetters)
+	}
+
+	easting := float64(col+1) * 100000
+	northing := float64(row) * 100000
+	for northing < mgrsBandNorthings[band] {
+		northing += 2000000
+	}
+
+	precision := math.Pow10(5 - len(m[5]))
+	if len(m[5]) > 0 {
+		e, _ := strconv.Atoi(m[5])
+		n, _ := strconv.Atoi(m[6])
+		easting += float64(e) * precision
+		northing += float64(n) * precision
+	}
+
+	north := band >= 'N'
+	corners := [][2]float64{
+		{easting, northing},
+		{easting + precision, northing},
+		{easting + precision, northing + precision},
+		{easting, northing + precision},
+		{easting + precision/2, northing + precision/2},
+	}
+	positions := make([]interface{}, len(corners))
+	for i, c := range corners {
+		lng, lat, err := utmPosition(zone, north, c[0], c[1])
+		if err != nil {
+			return nil, err
+		}
+		positions[i] = newPosition(lng, lat)
+	}
+
+	ring := []interface{}{positions[0], positions[1], positions[2], positions[3], positions[0]}
+	props := map[string]interface{}{
+		"mgrs":      strings.Join(m[1:], ""),
+		"precision": precision,
+	}
+	return ringCellGeos(kp, ring, positions[4].([]interface{}), props), nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestParseMGRS(t *testing.T) {
+	for _, test := range []struct {
+		ref       string
+		southwest []float64
+		precision float64
+	}{
+		{"18SUJ2348306479", []float64{-77.03524, 38.88946}, 1},
+		{"18S UJ 23483 06479", []float64{-77.03524, 38.88946}, 1},
+		{"18suj23480647", []float64{-77.03528, 38.88938}, 10},
+		{"18SUJ2306", []float64{-77.04068, 38.88505}, 1000},
+	} {
+		geos, err := parseMGRS(test.ref, []interface{}{"grid"})
+		assert.Equal(t, nil, err, test.ref)
+		assert.Equal(t, 2, len(geos), test.ref)
+
+		props := geos[0].Geo["properties"].(map[string]interface{})
+		assert.Equal(t, test.precision, props["precision"], test.ref)
+
+		ring := geos[0].Geo["geometry"].(map[string]interface{})["coordinates"].([]interface{})[0].([]interface{})
+		assert.Equal(t, 5, len(ring), test.ref)
+		assert.Equal(t, ring[0], ring[4], test.ref)
+
+		sw := ring[0].([]interface{})
+		assertNear(t, test.southwest, []float64{sw[0].(float64), sw[1].(float64)}, 1e-5)
+	}
+
+	geos, err := parseMGRS("18SUJ2348306479", nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "18SUJ2348306479", geos[1].Geo["properties"].(map[string]interface{})["mgrs"])
+	center := geos[1].Geo["geometry"].(map[string]interface{})["coordinates"].([]interface{})
+	assertNear(t, []float64{-77.03524, 38.88946}, []float64{center[0].(float64), center[1].(float64)}, 1e-5)
+
+	for _, s := range []string{
+		"",
+		"18SUJ234830647",       // odd number of digits
+		"18SUJ 2348 06479",     // easting and northing of different precisions
+		"18SUJ234832348306479", // too many digits
+		"18IUJ2348306479",      // I isn't a band
+		"18SAJ2348306479",      // A isn't a column in zone 18
+		"61SUJ2348306479",
+		"18SUJ", // a 100km square with no digits
+		"10MAD",
+		"1CAT",
+		"hello",
+	} {
+		_, err := parseMGRS(s, nil)
+		assert.Equal(t, errNotMGRS, err, s)
+	}
+}
+
+func TestParseMGRSInRequest(t *testing.T) {
+	gr := NewGeobinRequest(0, nil, []byte(`{"position": "18SUJ2348306479", "callsign": "ALPHA1"}`))
+
+	assert.Equal(t, 2, len(gr.Geo))
+	for _, g := range gr.Geo {
+		assert.Equal(t, []interface{}{"position"}, g.Path)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// how long to keep a migrated bin that had no expiration set in redis
+const migrateDefaultTTL = 48 * time.Hour
+
+// runMigration copies every bin from the redis server in conf into the Store named by
+// conf.Store. It is run instead of the server when geobin is started with -migrate.
+func runMigration(conf *Config) {
+	if conf.Store == storeRedis {
+		log.Fatal("Store is set to redis in ", configFile, ", there is nothing to migrate to.")
+	}
+
+	client, err := newRedisClient(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	be, err := newBackend(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer be.close()
+
+	n, err := migrateRedis(&redisStore{NewRedisWrapper(client)}, be.Store)
+	if err != nil {
+		log.Fatal("Migration failed after ", n, " bins: ", err)
+	}
+	log.Println("Migrated", n, "bins from redis to the", conf.Store, "store")
+}
+
+// migrateRedis copies every bin in src, along with its requests and remaining lifetime,
+// into dst. It returns the number of bins that were copied. Bins that expire while it
+// runs are skipped, and bins that are already in dst, from an earlier migration that
+// didn't finish, are replaced, so a migration can be run again until it succeeds.
+func migrateRedis(src *redisStore, dst Store) (int, error) {
+	names, err := src.Bins()
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, name := range names {
+		ttl, err := src.TTL(name)
+		if err == errBinNotFound {
+			debugLog("Skipping", name, "which has expired")
+			continue
+		} else if err != nil {
+			return migrated, err
+		}
+
+		if ttl == noExpiry {
+			ttl = migrateDefaultTTL
+		}
+
+		history, err := src.History(name)
+		if err != nil {
+			return migrated, err
+		}
+
+		exists, err := dst.BinExists(name)
+		if err != nil {
+			return migrated, err
+		}
+		if exists {
+			if err = dst.DeleteBin(name); err != nil {
+				return migrated, err
+			}
+		}
+
+		if err = dst.CreateBin(name, ttl); err != nil {
+			return migrated, err
+		}
+
+		// history is newest first, add them back in the order they were received
+		for i := len(history) - 1; i >= 0; i-- {
+			var gr struct {
+				Timestamp int64 `json:"timestamp"`
+			}
+			if err := json.Unmarshal([]byte(history[i]), &gr); err != nil {
+				log.Println("Skipping unreadable request in", name, err)
+				continue
+			}
+
+			// everything is copied over as it is, leaving retention limits to be applied
+			// the next time something is posted to the bin
+			if _, err = dst.AddRequest(name, gr.Timestamp, history[i], retention{}); err != nil {
+				return migrated, err
+			}
+		}
+
+		debugLog("Migrated", name, "with", len(history), "requests")
+		migrated++
+	}
+
+	return migrated, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+	"github.com/go-redis/redis"
+)
+
+func TestMigrateRedis(t *testing.T) {
+	src := &redisStore{NewMockRedis()}
+	assert.Equal(t, nil, src.CreateBin("empty", time.Hour))
+	assert.Equal(t, nil, src.CreateBin("full", time.Hour))
+	for i := 1; i <= 3; i++ {
+		assert.Equal(t, nil, addRequest(src, "full", int64(i), fmt.Sprintf(`{"timestamp":%d}`, i)))
+	}
+
+	// rate limit counters shouldn't be mistaken for bins
+	_, err := src.Incr("rate-limit:/full:1", time.Second)
+	assert.Equal(t, nil, err)
+
+	dst := NewMemoryStore()
+	n, err := migrateRedis(src, dst)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, n)
+
+	count, err := dst.Count("empty")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(0), count)
+
+	history, err := dst.History("full")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{`{"timestamp":3}`, `{"timestamp":2}`, `{"timestamp":1}`}, history)
+}
+
+func TestMigrateRedisAgain(t *testing.T) {
+	mr := NewMockRedis()
+	src := &redisStore{mr}
+	assert.Equal(t, nil, src.CreateBin("full", time.Hour))
+	for i := 1; i <= 2; i++ {
+		assert.Equal(t, nil, addRequest(src, "full", int64(i), fmt.Sprintf(`{"timestamp":%d}`, i)))
+	}
+
+	// a bin that expires after it's listed, but before it's copied, is skipped
+	_, err := mr.ZAdd("expired", redis.Z{Score: 0, Member: ""})
+	assert.Equal(t, nil, err)
+	_, err = mr.Expire("expired", -time.Second)
+	assert.Equal(t, nil, err)
+
+	// and one left half copied by an earlier run is copied again
+	dst := NewMemoryStore()
+	assert.Equal(t, nil, dst.CreateBin("full", time.Hour))
+	assert.Equal(t, nil, addRequest(dst, "full", 1, `{"timestamp":1}`))
+
+	n, err := migrateRedis(src, dst)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, n)
+
+	history, err := dst.History("full")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{`{"timestamp":2}`, `{"timestamp":1}`}, history)
+
+	exists, err := dst.BinExists("expired")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, exists)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// nmeaUERE is the user equivalent range error, in meters, that a fix's HDOP is multiplied by
+	// to get its radius
+	nmeaUERE = 5.0
+	// how many meters per second a knot is
+	metersPerSecondPerKnot = 1852.0 / 3600
+)
+
+var errNoNMEAFixes = errors.New("no valid fixes in NMEA sentences")
+
+// nmeaFixQualities names the fix qualities in GGA sentences.
+var nmeaFixQualities = map[int]string{
+	1: "GPS",
+	2: "DGPS",
+	3: "PPS",
+	4: "RTK",
+	5: "Float RTK",
+	6: "Estimated",
+	7: "Manual",
+	8: "Simulation",
+}
+
+// nmeaFix is a position put together from the sentences a receiver sends for a single moment.
+type nmeaFix struct {
+	line       int
+	lng, lat   float64
+	time       string
+	radius     float64
+	properties map[string]interface{}
+}
+
+// nmeaSentence splits an NMEA 0183 sentence into its type, such as "GGA", and its fields,
+// checking its checksum, which must be there as two hex digits after a "*". It returns false if
+// the line isn't a valid sentence.
+func nmeaSentence(line string) (string, []string, bool) {
+	i := strings.IndexAny(line, "$!")
+	if i < 0 {
+		return "", nil, false
+	}
+	line = strings.TrimSpace(line[i+1:])
+
+	i = strings.LastIndex(line, "*")
+	if i < 0 || len(line)-i != 3 {
+		return "", nil, false
+	}
+	sum, err := strconv.ParseUint(line[i+1:], 16, 8)
+	if err != nil {
+		return "", nil, false
+	}
+
+	line = line[:i]
+	var check byte
+	for j := 0; j < len(line); j++ {
+		check ^= line[j]
+	}
+	if byte(sum) != check {
+		return "", nil, false
+	}
+
+	fields := strings.Split(line, ",")
+	// the address is a two letter talker id, such as GP or GN, followed by the sentence type
+	if len(fields[0]) != 5 {
+		return "", nil, false
+	}
+	for j := 0; j < 5; j++ {
+		if fields[0][j] < 'A' || fields[0][j] > 'Z' {
+			return "", nil, false
+		}
+	}
+	return fields[0][2:], fields[1:], true
+}
+
+// sniffNMEA checks whether any of the first few lines of body is an NMEA sentence.
+func sniffNMEA(body []byte) bool {
+	if len(body) > 1024 {
+		body = body[:1024]
+	}
+
+	for _, line := range strings.Split(string(body), "\n") {
+		if _, _, ok := nmeaSentence(line); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNMEA finds the fixes in NMEA 0183 GGA, RMC, GLL and VTG sentences, one per line. The
+// sentences a receiver sends for the same moment are put together into one fix. Sentences with
+// missing or bad checksums, or that say their fix isn't valid, are skipped. Each fix becomes a Point
+// Feature, with a radius worked out from its HDOP, and its fix quality, satellites, altitude,
+// speed (in meters per second) and heading kept as properties when they're known. The path of
+// each is the index of the line its first sentence is on. If there is more than one fix they are
+// also put together into a LineString Feature with the path ["track"].
+func parseNMEA(body []byte) ([]Geo, error) {
+	fixes := make([]*nmeaFix, 0)
+	var last *nmeaFix
+
+	// fix returns the fix for a sentence at the given time, which is the last one if the time
+	// is the same, or a new one otherwise
+	fix := func(line int, time string) *nmeaFix {
+		if last != nil && time != "" && time == last.time {
+			return last
+		}
+		last = &nmeaFix{line: line, time: time, properties: make(map[string]interface{})}
+		if time != "" {
+			last.properties["time"] = time
+		}
+		fixes = append(fixes, last)
+		return last
+	}
+
+	for i, line := range strings.Split(string(body), "\n") {
+		t, fields, ok := nmeaSentence(line)
+		if !ok {
+			continue
+		}
+
+		switch t {
+		case "GGA":
+			if len(fields) < 9 {
+				continue
+			}
+
+			lat, lng, ok := nmeaPosition(fields[1:5])
+			quality, _ := strconv.Atoi(fields[5])
+			if !ok || quality == 0 {
+				continue
+			}
+
+			f := fix(i, fields[0])
+			f.lat, f.lng = lat, lng
+			f.properties["fixQuality"] = quality
+			if name, ok := nmeaFixQualities[quality]; ok {
+				f.properties["fixType"] = name
+			}
+			if sats, err := strconv.Atoi(fields[6]); err == nil {
+				f.properties["satellites"] = sats
+			}
+			if hdop, err := strconv.ParseFloat(fields[7], 64); err == nil {
+				f.properties["hdop"] = hdop
+				f.radius = hdop * nmeaUERE
+			}
+			if alt, err := strconv.ParseFloat(fields[8], 64); err == nil {
+				f.properties["altitude"] = alt
+			}
+		case "RMC":
+			if len(fields) < 9 || fields[1] != "A" {
+				continue
+			}
+
+			lat, lng, ok := nmeaPosition(fields[2:6])
+			if !ok {
+				continue
+			}
+
+			f := fix(i, fields[0])
+			f.lat, f.lng = lat, lng
+			nmeaCourse(f, fields[6], fields[7])
+			if fields[8] != "" {
+				f.properties["date"] = fields[8]
+			}
+		case "GLL":
+			if len(fields) < 6 || fields[5] != "A" {
+				continue
+			}
+
+			lat, lng, ok := nmeaPosition(fields[0:4])
+			if !ok {
+				continue
+			}
+
+			f := fix(i, fields[4])
+			f.lat, f.lng = lat, lng
+		case "VTG":
+			// VTG sentences have no position or time of their own, so they belong to the
+			// fix before them
+			if len(fields) < 5 || last == nil {
+				continue
+			}
+			nmeaCourse(last, fields[4], fields[0])
+		}
+	}
+
+	if len(fixes) == 0 {
+		return nil, errNoNMEAFixes
+	}
+
+	geos := make([]Geo, 0, len(fixes)+1)
+	coords := make([]interface{}, len(fixes))
+	times := make([]interface{}, len(fixes))
+	var hasTimes bool
+	for i, f := range fixes {
+		geos = append(geos, Geo{
+			Geo:    newFeature(newGeometry("Point", newPosition(f.lng, f.lat)), f.properties),
+			Radius: f.radius,
+			Path:   []interface{}{f.line},
+		})
+		coords[i] = newPosition(f.lng, f.lat)
+		if f.time != "" {
+			times[i], hasTimes = f.time, true
+		}
+	}
+
+	if len(fixes) > 1 {
+		props := make(map[string]interface{})
+		if hasTimes {
+			props["coordTimes"] = times
+		}
+
+		geos = append(geos, Geo{
+			Geo:  newFeature(newGeometry("LineString", coords), props),
+			Path: []interface{}{"track"},
+		})
+	}
+	return geos, nil
+}
+
+// nmeaPosition parses the latitude, N or S, longitude and E or W fields of a sentence.
+func nmeaPosition(fields []string) (float64, float64, bool) {
+	lat, latOK := nmeaDegrees(fields[0], fields[1], "N", "S")
+	lng, lngOK := nmeaDegrees(fields[2], fields[3], "E", "W")
+	if !latOK || !lngOK || !latIsValid(lat) || !lngIsValid(lng) {
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
+
+// nmeaDegrees converts an NMEA angle, which is in degrees and decimal minutes (dddmm.mmmm), to
+// decimal degrees, negating it if its hemisphere is neg.
+func nmeaDegrees(v, hemisphere, pos, neg string) (float64, bool) {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || (hemisphere != pos && hemisphere != neg) {
+		return 0, false
+	}
+
+	deg := math.Floor(f / 100)
+	mins := f - deg*100
+	if mins >= 60 {
+		return 0, false
+	}
+
+	d := deg + mins/60
+	if hemisphere == neg {
+		d = -d
+	}
+	return d, true
+}
+
+// nmeaCourse sets the speed and heading of a fix from a speed in knots and a heading in degrees,
+// if they're there.
+func nmeaCourse(f *nmeaFix, knots, heading string) {
+	if s, err := strconv.ParseFloat(knots, 64); err == nil {
+		f.properties["speed"] = s * metersPerSecondPerKnot
+	}
+	if h, err := strconv.ParseFloat(heading, 64); err == nil {
+		f.properties["heading"] = h
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+const testNMEA = `$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47
+$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A
+$GPVTG,054.7,T,034.4,M,005.5,N,010.2,K*48
+$GPGLL,4916.45,N,12311.12,W,225444,A*31
+$GPGLL,4916.45,N,12311.12,W,225444,A*32
+$GPRMC,225445,V,4916.45,N,12311.12,W,000.5,054.7,191194,020.3,E*7C
+$GNGGA,225446,4916.46,N,12311.13,W,0,00,,,M,,M,,*58
+garbage
+$GPGGA,225447,4916.47,N,12311.14,W,2,06,1.5,10.0,M,,M,,*70
+`
+
+func TestParseNMEA(t *testing.T) {
+	geos, err := parseNMEA([]byte(testNMEA))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, len(geos))
+
+	// the GGA, RMC and VTG sentences at 12:35:19 are one fix
+	first := geos[0]
+	assert.Equal(t, []interface{}{0}, first.Path)
+	assert.Equal(t, 4.5, first.Radius)
+	coords := first.Geo["geometry"].(map[string]interface{})["coordinates"].([]interface{})
+	assert.T(t, math.Abs(coords[0].(float64)-11.516667) < 0.00001, coords)
+	assert.T(t, math.Abs(coords[1].(float64)-48.1173) < 0.00001, coords)
+
+	props := first.Geo["properties"].(map[string]interface{})
+	assert.Equal(t, "123519", props["time"])
+	assert.Equal(t, "230394", props["date"])
+	assert.Equal(t, 1, props["fixQuality"])
+	assert.Equal(t, "GPS", props["fixType"])
+	assert.Equal(t, 8, props["satellites"])
+	assert.Equal(t, 545.4, props["altitude"])
+	assert.Equal(t, 54.7, props["heading"])
+	assert.T(t, math.Abs(props["speed"].(float64)-2.829) < 0.001, props["speed"])
+
+	// the GLL with a bad checksum and the invalid fixes are skipped
+	assert.Equal(t, []interface{}{3}, geos[1].Path)
+	coords = geos[1].Geo["geometry"].(map[string]interface{})["coordinates"].([]interface{})
+	assert.T(t, coords[0].(float64) < -123, coords)
+	assert.Equal(t, []interface{}{8}, geos[2].Path)
+
+	track := geos[3]
+	assert.Equal(t, []interface{}{"track"}, track.Path)
+	assert.Equal(t, "LineString", track.Geo["geometry"].(map[string]interface{})["type"])
+	assert.Equal(t, []interface{}{"123519", "225444", "225447"}, track.Geo["properties"].(map[string]interface{})["coordTimes"])
+
+	_, err = parseNMEA([]byte("$GPGLL,4916.45,N,12311.12,W,225444,V*26\n"))
+	assert.Equal(t, errNoNMEAFixes, err)
+
+	// sentences without a checksum are skipped too
+	_, err = parseNMEA([]byte("$GPGLL,4916.45,N,12311.12,W,225444,A\n$GPGLL,4916.45,N,12311.12,W,225444,A*\n"))
+	assert.Equal(t, errNoNMEAFixes, err)
+}
+
+func TestNMEARequest(t *testing.T) {
+	gr := NewGeobinRequest(0, nil, []byte("\r\n"+testNMEA))
+	assert.Equal(t, 4, len(gr.Geo))
+
+	// a single fix doesn't make a track
+	gr = NewGeobinRequest(0, nil, []byte("$GPGLL,4916.45,N,12311.12,W,225444,A*31\r\n"))
+	assert.Equal(t, 1, len(gr.Geo))
+}
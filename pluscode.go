@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+const (
+	// olcAlphabet is the alphabet plus codes are written in, the value of each digit being its index
+	olcAlphabet = "23456789CFGHJMPQRVWX"
+	// the separator, which always comes after the eighth digit of a full code, and the padding
+	// that fills in for the digits of a low precision code before it
+	olcSeparator    = '+'
+	olcSeparatorPos = 8
+	olcPadding      = '0'
+	// the first ten digits are pairs of latitude and longitude digits, and any after that are
+	// each a cell in a grid of five rows and four columns
+	olcPairLength = 10
+	olcMaxLength  = 15
+	olcGridRows   = 5
+	olcGridCols   = 4
+	// how many of the smallest grid cells there are in a degree of latitude and longitude, so
+	// that codes can be decoded exactly with integers
+	olcLatPrecision = 8000 * 3125
+	olcLngPrecision = 8000 * 1024
+)
+
+var errInvalidPlusCode = errors.New("invalid plus code")
+
+// isPlusCodeKey reports whether the given key holds plus codes, including short codes that need a
+// reference location. Keys are matched case insensitively.
+func isPlusCodeKey(k string) bool {
+	switch strings.ToLower(k) {
+	case "pluscode", "plus_code", "plus-code", "olc":
+		return true
+	}
+	return false
+}
+
+// parsePlusCode decodes s, if it is a full plus code, into the Polygon of its cell and the Point
+// at the cell's center. See plusCodeCell for their properties. It returns false if s isn't a full
+// plus code.
+func parsePlusCode(s string, kp []interface{}) ([]Geo, bool) {
+	code, full, err := checkPlusCode(s)
+	if err != nil || !full {
+		return nil, false
+	}
+	return plusCodeCell(code, kp, nil), true
+}
+
+// plusCodeGeos decodes the plus codes under the plus code keys of an object that has a location
+// of its own, which is ref. Short codes, which leave out the first few digits of the code, are
+// recovered using ref as the reference location. The path of each is the path of the object with
+// the code's key added.
+func plusCodeGeos(o map[string]interface{}, ref *Geo, kp []interface{}) []Geo {
+	geos := make([]Geo, 0)
+	for k, v := range o {
+		s, ok := v.(string)
+		if !ok || !isPlusCodeKey(k) {
+			continue
+		}
+
+		code, full, err := checkPlusCode(s)
+		if err != nil {
+			debugLog("Invalid plus code:", s, err)
+			continue
+		}
+
+		props := make(map[string]interface{})
+		if !full {
+			lng, lat, ok := geoPosition(ref)
+			if !ok {
+				continue
+			}
+
+			props["shortCode"] = code
+			code = recoverPlusCode(code, lat, lng)
+		}
+
+		geos = append(geos, plusCodeCell(code, appendPath(kp, k), props)...)
+	}
+	return geos
+}
+
+// plusCodeCell returns the cell geos of a valid full plus code, with the code and its precision,
+// which is the number of digits in it, added to the given properties.
+func plusCodeCell(code string, kp []interface{}, props map[string]interface{}) []Geo {
+	west, south, east, north, digits := decodePlusCode(code)
+	if props == nil {
+		props = make(map[string]interface{})
+	}
+	props["pluscode"] = code
+	props["precision"] = digits
+	return cellGeos(kp, west, south, east, north, props)
+}
+
+// checkPlusCode checks that s is a valid plus code, and returns it upper cased along with
+// whether it is a full code or a short one.
+func checkPlusCode(s string) (string, bool, error) {
+	code := strings.ToUpper(s)
+	// there's only one separator, after an even number of digits, and never just one digit
+	// after it
+	sep := strings.IndexByte(code, olcSeparator)
+	if sep <= 0 || sep > olcSeparatorPos || sep%2 != 0 || strings.LastIndexByte(code, olcSeparator) != sep {
+		return "", false, errInvalidPlusCode
+	}
+	after := len(code) - sep - 1
+	if after == 1 {
+		return "", false, errInvalidPlusCode
+	}
+
+	digits := code[:sep]
+	if pad := strings.IndexByte(digits, olcPadding); pad >= 0 {
+		// padding only fills out the pairs of digits before the separator of a full code
+		if sep != olcSeparatorPos || pad == 0 || pad%2 != 0 || after > 0 || strings.Trim(digits[pad:], string(olcPadding)) != "" {
+			return "", false, errInvalidPlusCode
+		}
+		digits = digits[:pad]
+	}
+	if len(digits)+after > olcMaxLength {
+		return "", false, errInvalidPlusCode
+	}
+
+	for _, c := range []byte(digits + code[sep+1:]) {
+		if strings.IndexByte(olcAlphabet, c) < 0 {
+			return "", false, errInvalidPlusCode
+		}
+	}
+
+	full := sep == olcSeparatorPos
+	// the first latitude digit can't go past 90 degrees, and the first longitude digit can't
+	// go past 180
+	if full && (strings.IndexByte(olcAlphabet, digits[0])*20 >= 180 || strings.IndexByte(olcAlphabet, digits[1])*20 >= 360) {
+		return "", false, errInvalidPlusCode
+	}
+	return code, full, nil
+}
+
+// decodePlusCode returns the bounds of the cell that a valid full plus code stands for, along
+// with the number of digits in it.
+func decodePlusCode(code string) (west, south, east, north float64, digits int) {
+	d := strings.Map(func(r rune) rune {
+		if r == olcSeparator || r == olcPadding {
+			return -1
+		}
+		return r
+	}, code)
+
+	value := func(c byte) int64 { return int64(strings.IndexByte(olcAlphabet, c)) }
+
+	// the place value of the first pair is 20 degrees
+	latPlace, lngPlace := int64(400*olcLatPrecision), int64(400*olcLngPrecision)
+	var lat, lng int64
+	for i := 0; i+1 < len(d) && i < olcPairLength; i += 2 {
+		latPlace /= 20
+		lngPlace /= 20
+		lat += value(d[i]) * latPlace
+		lng += value(d[i+1]) * lngPlace
+	}
+	for i := olcPairLength; i < len(d); i++ {
+		latPlace /= olcGridRows
+		lngPlace /= olcGridCols
+		lat += value(d[i]) / olcGridCols * latPlace
+		lng += value(d[i]) % olcGridCols * lngPlace
+	}
+
+	// subtract the offsets before dividing, so that the bounds are as exact as they can be
+	lat -= 90 * olcLatPrecision
+	lng -= 180 * olcLngPrecision
+	south = float64(lat) / olcLatPrecision
+	north = float64(lat+latPlace) / olcLatPrecision
+	west = float64(lng) / olcLngPrecision
+	east = float64(lng+lngPlace) / olcLngPrecision
+	return west, south, east, north, len(d)
+}
+
+// recoverPlusCode turns a short plus code into a full one, by taking the digits it leaves out
+// from the code of the reference location. That gives the cell nearest the reference location,
+// unless the reference location is near the edge of the area the short code could be in, in
+// which case the cell next to it on the other side of the edge might be nearer.
+func recoverPlusCode(short string, lat, lng float64) string {
+	sep := strings.IndexByte(short, olcSeparator)
+	missing := olcSeparatorPos - sep
+
+	code := encodePlusCode(lat, lng, missing) + short
+	west, south, east, north, _ := decodePlusCode(code)
+	centerLat, centerLng := (south+north)/2, (west+east)/2
+
+	// the size of the area the short code could be in
+	resolution := math.Pow(20, float64(2-missing/2))
+	half := resolution / 2
+
+	if lat+half < centerLat && centerLat-resolution >= -90 {
+		centerLat -= resolution
+	} else if lat-half > centerLat && centerLat+resolution <= 90 {
+		centerLat += resolution
+	}
+	if lng+half < centerLng {
+		centerLng -= resolution
+	} else if lng-half > centerLng {
+		centerLng += resolution
+	}
+
+	return encodePlusCode(centerLat, centerLng, missing) + short
+}
+
+// encodePlusCode returns the first n digits of the plus code for a location, n being even and no
+// more than olcPairLength.
+func encodePlusCode(lat, lng float64, n int) string {
+	lat = math.Min(math.Max(lat, -90), 90)
+	for lng < -180 {
+		lng += 360
+	}
+	for lng >= 180 {
+		lng -= 360
+	}
+
+	latValue := int64(math.Floor((lat + 90) * olcLatPrecision))
+	lngValue := int64(math.Floor((lng + 180) * olcLngPrecision))
+	// a latitude of 90 would need a digit past the end of the alphabet, so it goes in the cell
+	// below it
+	if latValue >= 180*olcLatPrecision {
+		latValue = 180*olcLatPrecision - 1
+	}
+
+	latPlace, lngPlace := int64(400*olcLatPrecision), int64(400*olcLngPrecision)
+	code := make([]byte, 0, n)
+	for i := 0; i < n; i += 2 {
+		latPlace /= 20
+		lngPlace /= 20
+		code = append(code, olcAlphabet[latValue/latPlace%20], olcAlphabet[lngValue/lngPlace%20])
+	}
+	return string(code)
+}
+
+// geoPosition returns the longitude and latitude of a Geo holding a GeoJSON Point, like the ones
+// isOtherGeo finds.
+func geoPosition(g *Geo) (float64, float64, bool) {
+	if g == nil {
+		return 0, 0, false
+	}
+
+	coords, ok := g.Geo["coordinates"].([]interface{})
+	if !ok || len(coords) < 2 {
+		return 0, 0, false
+	}
+
+	lng, lngOK := coords[0].(float64)
+	lat, latOK := coords[1].(float64)
+	return lng, lat, lngOK && latOK
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestDecodePlusCode(t *testing.T) {
+	for _, test := range []struct {
+		code   string
+		bounds []float64
+		digits int
+	}{
+		{"84QVG8M5+2V", []float64{-122.690375, 45.5325, -122.69025, 45.532625}, 10},
+		{"84QVG8M5+2VX", []float64{-122.69028125, 45.5326, -122.69025, 45.532625}, 11},
+		{"849VCWC8+R9", []float64{-122.084125, 37.422, -122.084, 37.422125}, 10},
+		{"8FVC9G00+", []float64{8.5, 47.35, 8.55, 47.4}, 6},
+	} {
+		west, south, east, north, digits := decodePlusCode(test.code)
+		assert.Equal(t, test.bounds, []float64{west, south, east, north}, test.code)
+		assert.Equal(t, test.digits, digits, test.code)
+	}
+}
+
+func TestCheckPlusCode(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		full bool
+	}{
+		{"84QVG8M5+2V", true},
+		{"849vcwc8+r9", true},
+		{"8FVC9G00+", true},
+		{"84QVG8M5+", true},
+		{"CWC8+R9", false},
+		{"22+", false},
+	} {
+		code, full, err := checkPlusCode(test.s)
+		assert.Equal(t, nil, err, test.s)
+		assert.Equal(t, test.full, full, test.s)
+		assert.Equal(t, len(test.s), len(code), test.s)
+	}
+
+	for _, s := range []string{
+		"",
+		"84QVG8M5",          // no separator
+		"84QVG8M52V",        // no separator
+		"84QVG8M5+2",        // one digit after the separator
+		"84QVG8M+52V",       // separator after an odd number of digits
+		"84QVG8M52+V",       // separator too late
+		"+2V",               // nothing before the separator
+		"84QV+G8M5+2V",      // two separators
+		"84QVG8M5+2A",       // A isn't in the alphabet
+		"8FVC9G00+2V",       // digits after padding
+		"8FVC9G0+",          // odd padding
+		"8FVC0G00+",         // digits between padding
+		"F4QVG8M5+2V",       // latitude past 90
+		"8XQVG8M5+2V",       // longitude past 180
+		"84QVG8M5+2VXXXXXX", // too long
+	} {
+		_, _, err := checkPlusCode(s)
+		assert.Equal(t, errInvalidPlusCode, err, s)
+	}
+}
+
+func TestRecoverPlusCode(t *testing.T) {
+	assert.Equal(t, "849VCWC8+R9", recoverPlusCode("CWC8+R9", 37.4, -122.1))
+	assert.Equal(t, "8FJFW222+", recoverPlusCode("22+", 42.899, 9.012))
+	// the reference location is near the top of its degree of latitude, so the cell at the bottom
+	// of the next one up is nearer than the one at the bottom of its own
+	assert.Equal(t, "8FWC2222+", recoverPlusCode("2222+", 47.99, 8.5))
+}
+
+func TestParsePlusCodeInRequest(t *testing.T) {
+	gr := NewGeobinRequest(0, nil, []byte(`{
+		"dropoff": "84QVG8M5+2V",
+		"pickup": {"lat": 37.4, "lng": -122.1, "pluscode": "CWC8+R9"},
+		"depot": {"olc": "CWC8+R9"},
+		"note": "call at 8+ people"
+	}`))
+
+	cell := func(west, south, east, north float64, props map[string]interface{}, kp ...interface{}) []Geo {
+		return cellGeos(kp, west, south, east, north, props)
+	}
+	exp := cell(-122.690375, 45.5325, -122.69025, 45.532625, map[string]interface{}{
+		"pluscode":  "84QVG8M5+2V",
+		"precision": 10,
+	}, "dropoff")
+	exp = append(exp, cell(-122.084125, 37.422, -122.084, 37.422125, map[string]interface{}{
+		"pluscode":  "849VCWC8+R9",
+		"shortCode": "CWC8+R9",
+		"precision": 10,
+	}, "pickup", "pluscode")...)
+	exp = append(exp, Geo{
+		Geo:  map[string]interface{}{"type": "Point", "coordinates": []interface{}{-122.1, 37.4}},
+		Path: []interface{}{"pickup"},
+	})
+
+	testSlicesContainSameGeos(t, exp, gr.Geo)
+}
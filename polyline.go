@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// defaultPolylineKeys are the keys that strings are decoded as encoded polylines under, if the
+// PolylineKeys config value isn't set. See parsePolylineKeys for their format.
+var defaultPolylineKeys = []string{
+	"polyline",
+	"overview_polyline.points",
+	"encoded_polyline",
+	"encodedPolyline",
+	"shape:6",
+}
+
+var errInvalidPolyline = errors.New("invalid encoded polyline")
+
+// polylineKey is a key that strings are decoded as encoded polylines under.
+type polylineKey struct {
+	// the keys at the end of a value's path, lower cased, ignoring array indexes
+	path []string
+	// the precision the polylines are encoded at, or zero to work it out
+	precision int
+}
+
+// polylineKeys are the keys that parseString decodes strings under as encoded polylines. Set them
+// with setPolylineKeys.
+var polylineKeys = parsePolylineKeys(defaultPolylineKeys)
+
+// setPolylineKeys sets the keys that strings are decoded as encoded polylines under.
+func setPolylineKeys(keys []string) {
+	polylineKeys = parsePolylineKeys(keys)
+}
+
+// parsePolylineKeys parses keys of the form "key", "parent.key" or either of those followed by
+// ":precision", such as "shape:6". A key with a parent only matches values under that parent,
+// as "overview_polyline.points" does in Google's Directions API responses. Without a precision,
+// polylines are decoded at precision 5, unless that gives positions that are out of range and
+// precision 6 doesn't.
+func parsePolylineKeys(keys []string) []polylineKey {
+	pks := make([]polylineKey, 0, len(keys))
+	for _, k := range keys {
+		var pk polylineKey
+		if i := strings.LastIndex(k, ":"); i >= 0 {
+			p, err := strconv.Atoi(k[i+1:])
+			if err != nil || p < 1 || p > 9 {
+				debugLog("Invalid polyline key precision:", k)
+				continue
+			}
+			k, pk.precision = k[:i], p
+		}
+
+		pk.path = strings.Split(strings.ToLower(k), ".")
+		pks = append(pks, pk)
+	}
+	return pks
+}
+
+// matches reports whether the path of a value ends with the key, ignoring any array indexes.
+func (pk polylineKey) matches(kp []interface{}) bool {
+	i := len(pk.path) - 1
+	for j := len(kp) - 1; j >= 0 && i >= 0; j-- {
+		k, ok := kp[j].(string)
+		if !ok {
+			continue
+		}
+		if strings.ToLower(k) != pk.path[i] {
+			return false
+		}
+		i--
+	}
+	return i < 0
+}
+
+// parsePolyline decodes s as an encoded polyline if its path matches one of polylineKeys, and
+// returns a LineString, or a Point if it has only one position. It returns false if the path
+// doesn't match or s isn't a valid polyline.
+func parsePolyline(s string, kp []interface{}) (map[string]interface{}, bool) {
+	for _, pk := range polylineKeys {
+		if !pk.matches(kp) {
+			continue
+		}
+
+		var coords []interface{}
+		var err error
+		if pk.precision > 0 {
+			coords, err = decodePolyline(s, pk.precision)
+		} else if coords, err = decodePolyline(s, 5); err == errPositionOutOfRange {
+			coords, err = decodePolyline(s, 6)
+		}
+		if err != nil || len(coords) == 0 {
+			return nil, false
+		}
+
+		if len(coords) == 1 {
+			return newGeometry("Point", coords[0]), true
+		}
+		return newGeometry("LineString", coords), true
+	}
+	return nil, false
+}
+
+// decodePolyline decodes a polyline encoded with Google's algorithm at the given precision,
+// which is the number of decimal places the positions were rounded to.
+func decodePolyline(s string, precision int) ([]interface{}, error) {
+	factor := math.Pow10(precision)
+	coords := make([]interface{}, 0)
+
+	var lat, lng int64
+	for i := 0; i < len(s); {
+		// each position is the change in latitude then longitude from the one before it
+		var deltas [2]int64
+		for j := range deltas {
+			var result int64
+			for shift := uint(0); ; shift += 5 {
+				if i >= len(s) || shift > 60 {
+					return nil, errInvalidPolyline
+				}
+
+				b := int64(s[i]) - 63
+				i++
+				if b < 0 || b > 63 {
+					return nil, errInvalidPolyline
+				}
+
+				result |= (b & 0x1f) << shift
+				if b < 0x20 {
+					break
+				}
+			}
+
+			if result&1 != 0 {
+				deltas[j] = ^(result >> 1)
+			} else {
+				deltas[j] = result >> 1
+			}
+		}
+
+		lat += deltas[0]
+		lng += deltas[1]
+		y, x := float64(lat)/factor, float64(lng)/factor
+		if !latIsValid(y) || !lngIsValid(x) {
+			return nil, errPositionOutOfRange
+		}
+		coords = append(coords, newPosition(x, y))
+	}
+	return coords, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestDecodePolyline(t *testing.T) {
+	// the example from Google's documentation of the algorithm
+	coords, err := decodePolyline("_p~iF~ps|U_ulLnnqC_mqNvxq`@", 5)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []interface{}{
+		newPosition(-120.2, 38.5),
+		newPosition(-120.95, 40.7),
+		newPosition(-126.453, 43.252),
+	}, coords)
+
+	coords, err = decodePolyline("_izlhA~rlgdF_{geC~ywl@", 6)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []interface{}{
+		newPosition(-120.2, 38.5),
+		newPosition(-120.95, 40.7),
+	}, coords)
+
+	// the precision 6 polyline is out of range at precision 5
+	_, err = decodePolyline("_izlhA~rlgdF_{geC~ywl@", 5)
+	assert.Equal(t, errPositionOutOfRange, err)
+
+	for _, s := range []string{
+		"_p~iF~ps|U_ulL",    // ends half way through a position
+		"_p~iF~ps|U_ulLn",   // ends half way through a value
+		"_p~iF ~ps|U",       // has a character outside the encoding
+		"overview polyline", // isn't a polyline at all
+	} {
+		_, err := decodePolyline(s, 5)
+		assert.Equal(t, errInvalidPolyline, err, s)
+	}
+}
+
+func TestParsePolylineKeys(t *testing.T) {
+	pks := parsePolylineKeys([]string{"Polyline", "overview_polyline.points", "shape:6", "bad:x"})
+	assert.Equal(t, []polylineKey{
+		polylineKey{path: []string{"polyline"}},
+		polylineKey{path: []string{"overview_polyline", "points"}},
+		polylineKey{path: []string{"shape"}, precision: 6},
+	}, pks)
+
+	assert.Equal(t, true, pks[0].matches([]interface{}{"POLYLINE"}))
+	assert.Equal(t, true, pks[0].matches([]interface{}{"legs", 0, "polyline", 2}))
+	assert.Equal(t, false, pks[0].matches([]interface{}{"polyline", "name"}))
+	assert.Equal(t, true, pks[1].matches([]interface{}{"routes", 0, "overview_polyline", "points"}))
+	assert.Equal(t, false, pks[1].matches([]interface{}{"points"}))
+	assert.Equal(t, false, pks[1].matches([]interface{}{"steps", "points"}))
+}
+
+func TestParsePolylineInRequest(t *testing.T) {
+	gr := NewGeobinRequest(0, nil, []byte(`{
+		"routes": [{"overview_polyline": {"points": "_p~iF~ps|U_ulLnnqC_mqNvxq`+"`"+`@"}}],
+		"trip": {"shape": "_upzA_pihC_ibE_ibE"},
+		"stop": {"polyline": "_p~iF~ps|U"},
+		"encoded_polyline": "_izlhA~rlgdF_{geC~ywl@",
+		"name": "_p~iF~ps|U"
+	}`))
+
+	testSlicesContainSameGeos(t, []Geo{
+		Geo{
+			Geo: newGeometry("LineString", []interface{}{
+				newPosition(-120.2, 38.5),
+				newPosition(-120.95, 40.7),
+				newPosition(-126.453, 43.252),
+			}),
+			Path: []interface{}{"routes", 0, "overview_polyline", "points"},
+		},
+		Geo{
+			// shape is always precision 6, even though this would be in range at precision 5
+			Geo: newGeometry("LineString", []interface{}{
+				newPosition(2.25, 1.5),
+				newPosition(2.35, 1.6),
+			}),
+			Path: []interface{}{"trip", "shape"},
+		},
+		Geo{
+			Geo:  newGeometry("Point", newPosition(-120.2, 38.5)),
+			Path: []interface{}{"stop", "polyline"},
+		},
+		Geo{
+			// out of range at precision 5, so it's decoded at precision 6
+			Geo: newGeometry("LineString", []interface{}{
+				newPosition(-120.2, 38.5),
+				newPosition(-120.95, 40.7),
+			}),
+			Path: []interface{}{"encoded_polyline"},
+		},
+	}, gr.Geo)
+}
+
+func TestParsePolylineDeeplyNested(t *testing.T) {
+	// sibling values are parsed at the same time, so their paths mustn't share a backing array
+	for i := 0; i < 100; i++ {
+		gr := NewGeobinRequest(0, nil, []byte(`{"a": {"b": {"c": {
+			"polyline": "_p~iF~ps|U_ulLnnqC",
+			"note": "hello",
+			"other": "_p~iF~ps|U"
+		}}}}`))
+
+		assert.Equal(t, 1, len(gr.Geo))
+		assert.Equal(t, []interface{}{"a", "b", "c", "polyline"}, gr.Geo[0].Path)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// redisScanCount is how many keys each SCAN asks redis to look through.
+const redisScanCount = 100
+
+// redisStore is a Store backed by redis. Each bin is a sorted set of encoded requests
+// scored by timestamp. When a bin is created it is seeded with an empty placeholder
+// member so that the key exists (and can expire) before anything is posted to it.
+type redisStore struct {
+	rc RedisClient
+}
+
+// NewRedisStore creates a Store that keeps its data in redis using the given client.
+func NewRedisStore(rc RedisClient) Store {
+	return &redisStore{rc}
+}
+
+func (rs *redisStore) CreateBin(name string, ttl time.Duration) error {
+	if _, err := rs.rc.ZAdd(name, redis.Z{Score: 0, Member: ""}); err != nil {
+		return err
+	}
+
+	return rs.Expire(name, ttl)
+}
+
+func (rs *redisStore) BinExists(name string) (bool, error) {
+	return rs.rc.Exists(name)
+}
+
+func (rs *redisStore) AddRequest(name string, ts int64, encoded string, r retention) (int64, error) {
+	return rs.rc.ZAddTrimmed(name, redisUsageKey(name), redis.Z{Score: float64(ts), Member: encoded}, r)
+}
+
+func (rs *redisStore) History(name string) ([]string, error) {
+	set, err := rs.rc.ZRevRange(name, "0", "-1")
+	if err != nil {
+		return nil, err
+	}
+
+	// chop off the last member since it is the placeholder value from when the set was created
+	if n := len(set); n > 0 && set[n-1] == "" {
+		set = set[:n-1]
+	}
+
+	return set, nil
+}
+
+func (rs *redisStore) HistoryRange(name string, q historyQuery) ([]string, error) {
+	opt := redis.ZRangeByScore{
+		Min:    redisScoreMin(q.Since),
+		Max:    strconv.FormatInt(q.Until, 10),
+		Offset: q.Offset,
+		Count:  q.Limit,
+	}
+
+	// redis takes a negative count to mean no limit
+	if opt.Count == 0 {
+		opt.Count = -1
+	}
+
+	if q.Oldest {
+		return rs.rc.ZRangeByScore(name, opt)
+	}
+	return rs.rc.ZRevRangeByScore(name, opt)
+}
+
+func (rs *redisStore) Count(name string) (int64, error) {
+	c, err := rs.rc.ZCount(name, "-inf", "+inf")
+	if err != nil {
+		return 0, err
+	}
+
+	if c == 0 {
+		return 0, errBinNotFound
+	}
+
+	// don't count the placeholder
+	return c - 1, nil
+}
+
+func (rs *redisStore) CountRange(name string, since, until int64) (int64, error) {
+	return rs.rc.ZCount(name, redisScoreMin(since), strconv.FormatInt(until, 10))
+}
+
+func (rs *redisStore) Dropped(name string) (int64, error) {
+	v, err := rs.rc.HGet(redisUsageKey(name), "dropped")
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(v, 10, 64)
+}
+
+func (rs *redisStore) Expire(name string, ttl time.Duration) error {
+	for i, key := range rs.binKeys(name) {
+		ok, err := rs.rc.Expire(key, ttl)
+		if err != nil {
+			return err
+		}
+
+		// the bin's other keys don't exist until something is posted to it
+		if i == 0 && !ok {
+			return errBinNotFound
+		}
+	}
+	return nil
+}
+
+func (rs *redisStore) Incr(key string, ttl time.Duration) (int64, error) {
+	n, err := rs.rc.Incr(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if n == 1 {
+		if _, err = rs.rc.Expire(key, ttl); err != nil {
+			return 0, err
+		}
+	}
+
+	return n, nil
+}
+
+func (rs *redisStore) DeleteBin(name string) error {
+	n, err := rs.rc.Del(rs.binKeys(name)...)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return errBinNotFound
+	}
+	return nil
+}
+
+// binKeys returns all of the keys that hold data for the named bin, starting with the
+// bin itself.
+func (rs *redisStore) binKeys(name string) []string {
+	return []string{name, redisUsageKey(name)}
+}
+
+// redisUsageKey returns the key of the hash that keeps track of how many requests the
+// named bin holds, their total size, and how many have been dropped.
+func redisUsageKey(name string) string {
+	return "usage:" + name
+}
+
+// CountSince returns the number of requests in a bin received at or after ts (Unix time).
+func (rs *redisStore) CountSince(name string, ts int64) (int64, error) {
+	return rs.rc.ZCount(name, strconv.FormatInt(ts, 10), "+inf")
+}
+
+// Bins returns the names of every bin in redis. Bin names never contain a ":", which
+// is how they are told apart from the other keys (like rate limit counters) we keep.
+// The keys are looked through with SCAN rather than KEYS so that redis isn't blocked
+// while there are a lot of them.
+func (rs *redisStore) Bins() ([]string, error) {
+	bins := make([]string, 0)
+	seen := make(map[string]bool)
+	var cursor int64
+	for {
+		next, keys, err := rs.rc.Scan(cursor, "*", redisScanCount)
+		if err != nil {
+			return nil, err
+		}
+
+		// SCAN can return the same key more than once
+		for _, k := range keys {
+			if !strings.Contains(k, ":") && !seen[k] {
+				seen[k] = true
+				bins = append(bins, k)
+			}
+		}
+
+		if cursor = next; cursor == 0 {
+			return bins, nil
+		}
+	}
+}
+
+// TTL returns how long the named bin has left before it expires. Redis answers with -2s for
+// a key that doesn't exist and -1s for one that never expires, which become errBinNotFound
+// and noExpiry.
+func (rs *redisStore) TTL(name string) (time.Duration, error) {
+	ttl, err := rs.rc.TTL(name)
+	if err != nil {
+		return 0, err
+	}
+
+	switch ttl {
+	case -2 * time.Second:
+		return 0, errBinNotFound
+	case -1 * time.Second:
+		return noExpiry, nil
+	}
+	return ttl, nil
+}
+
+// redisScoreMin returns the lowest score to search a bin for requests received at or
+// after since, which is always above the placeholder's score of 0.
+func redisScoreMin(since int64) string {
+	if since < 1 {
+		return "(0"
+	}
+	return strconv.FormatInt(since, 10)
+}
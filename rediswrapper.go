@@ -1,6 +1,10 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -10,6 +14,7 @@ import (
 type PubSubber interface {
 	Subscribe(channels ...string) error
 	Unsubscribe(channels ...string) error
+	Publish(channel, message string) error
 }
 
 // mock our use of redis client for modularity/testing purposes
@@ -17,11 +22,21 @@ type RedisClient interface {
 	ZAdd(key string, members ...redis.Z) (int64, error)
 	ZCount(key, min, max string) (int64, error)
 	Expire(key string, dur time.Duration) (bool, error)
-	Publish(channel, message string) (int64, error)
 	ZRevRange(key, start, stop string) ([]string, error)
+	ZRangeByScore(key string, opt redis.ZRangeByScore) ([]string, error)
+	ZRevRangeByScore(key string, opt redis.ZRangeByScore) ([]string, error)
 	Exists(key string) (bool, error)
 	Get(key string) (string, error)
 	Incr(key string) (int64, error)
+	Scan(cursor int64, match string, count int64) (int64, []string, error)
+	TTL(key string) (time.Duration, error)
+	Del(keys ...string) (int64, error)
+	HGet(key, field string) (string, error)
+	// ZAddTrimmed adds member to the sorted set at key, then removes the lowest scored
+	// members until the set is back within r. The number of members and their total size
+	// are kept in the hash at usageKey. It returns the number of members removed, or
+	// errBinNotFound if there is no set at key.
+	ZAddTrimmed(key, usageKey string, member redis.Z, r retention) (int64, error)
 }
 
 // wraps redis.Client as a RedisClient above, which gives a simpler interface
@@ -46,14 +61,18 @@ func (rw *redisWrapper) Expire(key string, dur time.Duration) (bool, error) {
 	return rw.r.Expire(key, dur).Result()
 }
 
-func (rw *redisWrapper) Publish(channel, message string) (int64, error) {
-	return rw.r.Publish(channel, message).Result()
-}
-
 func (rw *redisWrapper) ZRevRange(key, start, stop string) ([]string, error) {
 	return rw.r.ZRevRange(key, start, stop).Result()
 }
 
+func (rw *redisWrapper) ZRangeByScore(key string, opt redis.ZRangeByScore) ([]string, error) {
+	return rw.r.ZRangeByScore(key, opt).Result()
+}
+
+func (rw *redisWrapper) ZRevRangeByScore(key string, opt redis.ZRangeByScore) ([]string, error) {
+	return rw.r.ZRevRangeByScore(key, opt).Result()
+}
+
 func (rw *redisWrapper) Exists(key string) (bool, error) {
 	return rw.r.Exists(key).Result()
 }
@@ -65,3 +84,157 @@ func (rw *redisWrapper) Get(key string) (string, error) {
 func (rw *redisWrapper) Incr(key string) (int64, error) {
 	return rw.r.Incr(key).Result()
 }
+
+func (rw *redisWrapper) Scan(cursor int64, match string, count int64) (int64, []string, error) {
+	return rw.r.Scan(cursor, match, count).Result()
+}
+
+func (rw *redisWrapper) TTL(key string) (time.Duration, error) {
+	return rw.r.TTL(key).Result()
+}
+
+func (rw *redisWrapper) Del(keys ...string) (int64, error) {
+	return rw.r.Del(keys...).Result()
+}
+
+func (rw *redisWrapper) HGet(key, field string) (string, error) {
+	return rw.r.HGet(key, field).Result()
+}
+
+// redisZAddTrimmedScript implements ZAddTrimmed, so that adding and trimming happen
+// atomically. The set's placeholder member has a score of 0 and is never counted or
+// removed, and neither is the last real member. The usage hash is given the same
+// expiration time as the set.
+const redisZAddTrimmedScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+
+local maxCount, maxBytes = tonumber(ARGV[3]), tonumber(ARGV[4])
+if redis.call('HEXISTS', KEYS[2], 'requests') == 0 then
+	local bytes = 0
+	for _, m in ipairs(redis.call('ZRANGEBYSCORE', KEYS[1], '(0', '+inf')) do
+		bytes = bytes + string.len(m)
+	end
+	redis.call('HMSET', KEYS[2], 'requests', redis.call('ZCARD', KEYS[1]) - 1, 'bytes', bytes)
+end
+
+if redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2]) == 1 then
+	redis.call('HINCRBY', KEYS[2], 'requests', 1)
+	redis.call('HINCRBY', KEYS[2], 'bytes', string.len(ARGV[2]))
+end
+
+local count = tonumber(redis.call('HGET', KEYS[2], 'requests'))
+local bytes = tonumber(redis.call('HGET', KEYS[2], 'bytes'))
+local dropped = 0
+while count > 1 and ((maxCount > 0 and count > maxCount) or (maxBytes > 0 and bytes > maxBytes)) do
+	local oldest = redis.call('ZRANGEBYSCORE', KEYS[1], '(0', '+inf', 'LIMIT', 0, 1)[1]
+	if not oldest then
+		break
+	end
+	redis.call('ZREM', KEYS[1], oldest)
+	count = count - 1
+	bytes = bytes - string.len(oldest)
+	dropped = dropped + 1
+end
+
+if dropped > 0 then
+	redis.call('HMSET', KEYS[2], 'requests', count, 'bytes', bytes)
+	redis.call('HINCRBY', KEYS[2], 'dropped', dropped)
+end
+
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[2], ttl)
+end
+return dropped
+`
+
+func (rw *redisWrapper) ZAddTrimmed(key, usageKey string, member redis.Z, r retention) (int64, error) {
+	v, err := rw.r.Eval(redisZAddTrimmedScript, []string{key, usageKey}, []string{
+		strconv.FormatFloat(member.Score, 'f', -1, 64),
+		member.Member,
+		strconv.FormatInt(r.MaxRequests, 10),
+		strconv.FormatInt(r.MaxBytes, 10),
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	dropped, ok := v.(int64)
+	if !ok {
+		return 0, errors.New("Unexpected reply from redis: " + fmt.Sprint(v))
+	}
+
+	if dropped < 0 {
+		return 0, errBinNotFound
+	}
+	return dropped, nil
+}
+
+// errPubSubClosed is returned when trying to reconnect a redisPubSub that has been closed.
+var errPubSubClosed = errors.New("PubSub has been closed.")
+
+// wraps redis.PubSub as a PubSubber above, publishing messages through the
+// redis.Client that opened it. If the pubsub connection is lost, it can be
+// replaced with a new one by calling reconnect.
+type redisPubSub struct {
+	lk     sync.Mutex
+	ps     *redis.PubSub
+	r      *redis.Client
+	closed bool
+}
+
+func NewRedisPubSub(r *redis.Client) *redisPubSub {
+	return &redisPubSub{ps: r.PubSub(), r: r}
+}
+
+func (rps *redisPubSub) Subscribe(channels ...string) error {
+	return rps.pubSub().Subscribe(channels...)
+}
+
+func (rps *redisPubSub) Unsubscribe(channels ...string) error {
+	return rps.pubSub().Unsubscribe(channels...)
+}
+
+func (rps *redisPubSub) Publish(channel, message string) error {
+	return rps.r.Publish(channel, message).Err()
+}
+
+func (rps *redisPubSub) Receive() (interface{}, error) {
+	return rps.pubSub().Receive()
+}
+
+func (rps *redisPubSub) Close() error {
+	rps.lk.Lock()
+	defer rps.lk.Unlock()
+	rps.closed = true
+	return rps.ps.Close()
+}
+
+// reconnect replaces the pubsub connection with a new one subscribed to the given channels.
+func (rps *redisPubSub) reconnect(channels []string) error {
+	rps.lk.Lock()
+	defer rps.lk.Unlock()
+	if rps.closed {
+		return errPubSubClosed
+	}
+
+	ps := rps.r.PubSub()
+	if len(channels) > 0 {
+		if err := ps.Subscribe(channels...); err != nil {
+			ps.Close()
+			return err
+		}
+	}
+
+	rps.ps.Close()
+	rps.ps = ps
+	return nil
+}
+
+func (rps *redisPubSub) pubSub() *redis.PubSub {
+	rps.lk.Lock()
+	defer rps.lk.Unlock()
+	return rps.ps
+}
@@ -23,6 +23,8 @@ const (
 type Socket interface {
 	// Submits a payload to the web socket as a text message.
 	Write([]byte)
+	// Submits a final payload to the web socket as a text message, then closes it.
+	CloseWith([]byte)
 	// return the provided name
 	GetName() string
 	// Close the socket.
@@ -42,8 +44,12 @@ type s struct {
 
 	shutdown  chan bool
 	closed    bool
+	closing   bool
 	closeLock *sync.Mutex
 
+	// closed once writePump has returned, after which nothing reads from send
+	done chan struct{}
+
 	// event functions
 	onRead  func(messageType int, message []byte)
 	onClose func(name string)
@@ -113,9 +119,10 @@ func socketSetup(name string, ws *websocket.Conn, or func(int, []byte), oc func(
 		name:      name,
 		ws:        ws,
 		send:      make(chan []byte, 256),
-		shutdown:  make(chan bool),
+		shutdown:  make(chan bool, 1),
 		closed:    false,
 		closeLock: &sync.Mutex{},
+		done:      make(chan struct{}),
 		onRead:    or,
 		onClose:   oc,
 	}
@@ -126,12 +133,41 @@ func socketSetup(name string, ws *websocket.Conn, or func(int, []byte), oc func(
 }
 
 func (s *s) Write(payload []byte) {
-	s.send <- payload
+	s.queue(payload)
+}
+
+// CloseWith only does anything the first time it's called, as both the expiry watcher and a
+// delete request can close the same bin's sockets.
+func (s *s) CloseWith(payload []byte) {
+	s.closeLock.Lock()
+	if s.closed || s.closing {
+		s.closeLock.Unlock()
+		return
+	}
+	s.closing = true
+	s.closeLock.Unlock()
+
+	if s.queue(payload) {
+		// a nil message tells writePump to close the socket
+		s.queue(nil)
+	}
+}
+
+// queue hands a message to writePump, and reports whether it could. Once writePump has
+// returned, say because the peer went away, the message is dropped rather than blocking forever.
+func (s *s) queue(message []byte) bool {
+	select {
+	case s.send <- message:
+		return true
+	case <-s.done:
+		return false
+	}
 }
 
 func (s *s) Close() {
 	s.closeLock.Lock()
 	if s.closed {
+		s.closeLock.Unlock()
 		return
 	}
 	s.closed = true
@@ -167,12 +203,19 @@ func (s *s) writePump() {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
+		close(s.done)
 	}()
 	for {
 		select {
 		case <-s.shutdown:
 			return
 		case message := <-s.send:
+			if message == nil {
+				s.write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				s.Close()
+				return
+			}
+
 			if err := s.write(websocket.TextMessage, message); err != nil {
 				log.Println("["+s.name+"]", "Error during socket write:", err)
 				s.Close()
@@ -102,6 +102,38 @@ func TestOnClose(t *testing.T) {
 	assert.Equal(t, uint64(1), atomic.LoadUint64(&clientClosed))
 }
 
+func TestCloseWithAfterPeerLeft(t *testing.T) {
+	ts := makeRoundTripServer(t, "test_socket", nil, nil)
+	defer ts.Close()
+
+	var clientClosed uint64
+	client := makeClient(t, ts.URL, "test_client", nil, func(name string) {
+		atomic.AddUint64(&clientClosed, 1)
+	})
+	client.Close()
+
+	// sleep a lil bit to allow the socket channels to communicate the shut down
+	time.Sleep(25 * time.Millisecond)
+
+	done := make(chan bool)
+	go func() {
+		// more than fit in the send buffer, none of which anything is left to read
+		for i := 0; i < 300; i++ {
+			client.Write([]byte("You got a message!"))
+		}
+		client.CloseWith([]byte("bye"))
+		client.CloseWith([]byte("bye"))
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Writing to a socket whose peer went away blocked")
+	}
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&clientClosed))
+}
+
 func makeRoundTripServer(t *testing.T, name string, or func(int, []byte), oc func(string)) *httptest.Server {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		sck, err := NewSocket(name, w, r, or, oc)
@@ -11,6 +11,8 @@ type SocketMap interface {
 	Get(binName, socketUUID string) (Socket, bool)
 	Delete(binName, socketUUID string) error
 	Send(binName string, payload []byte) error
+	CloseBin(binName string, payload []byte) error
+	Bins() []string
 }
 
 type UnSub interface {
@@ -108,3 +110,37 @@ func (sm *sm) Send(binName string, payload []byte) error {
 	}
 	return nil
 }
+
+// CloseBin sends a final payload to all of the sockets for a bin, then closes them.
+// As each socket closes it should Delete itself, the last of which unsubscribes from the bin.
+func (sm *sm) CloseBin(binName string, payload []byte) error {
+	sm.lk.Lock()
+	defer sm.lk.Unlock()
+	if sm.smap == nil {
+		return errors.New("There are no known sockets.")
+	}
+
+	sockets, ok := sm.smap[binName]
+	if !ok {
+		return errors.New(fmt.Sprint("Got close for unknown channel:", binName))
+	}
+
+	for _, s := range sockets {
+		go func(s Socket, p []byte) {
+			s.CloseWith(p)
+		}(s, payload)
+	}
+	return nil
+}
+
+// Bins returns the names of all of the bins that have at least one socket open.
+func (sm *sm) Bins() []string {
+	sm.lk.Lock()
+	defer sm.lk.Unlock()
+
+	bins := make([]string, 0, len(sm.smap))
+	for binName := range sm.smap {
+		bins = append(bins, binName)
+	}
+	return bins
+}
@@ -18,12 +18,34 @@ type MockSocket struct {
 	lk       sync.Mutex
 	name     string
 	didWrite bool
+	payloads []string
+	closed   bool
 }
 
 func (ms *MockSocket) Write(payload []byte) {
 	ms.lk.Lock()
 	defer ms.lk.Unlock()
 	ms.didWrite = true
+	ms.payloads = append(ms.payloads, string(payload))
+}
+
+func (ms *MockSocket) CloseWith(payload []byte) {
+	ms.Write(payload)
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+	ms.closed = true
+}
+
+func (ms *MockSocket) getClosed() bool {
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+	return ms.closed
+}
+
+func (ms *MockSocket) getPayloads() []string {
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+	return ms.payloads
 }
 
 func (ms *MockSocket) getDidWrite() bool {
@@ -96,6 +118,38 @@ func TestSend(t *testing.T) {
 	assert.Equal(t, true, ms.getDidWrite())
 }
 
+func TestCloseBin(t *testing.T) {
+	sm := NewSocketMap(getUnsubFunc(t))
+	err := sm.CloseBin("bin_name", []byte("goodbye"))
+	assert.NotEqual(t, nil, err)
+
+	ms1 := &MockSocket{name: "mock_socket1"}
+	ms2 := &MockSocket{name: "mock_socket2"}
+	other := &MockSocket{name: "other_socket"}
+	sm.Add("bin_name", "socket_uuid1", ms1)
+	sm.Add("bin_name", "socket_uuid2", ms2)
+	sm.Add("other_bin_name", "socket_uuid3", other)
+
+	err = sm.CloseBin("bin_name", []byte("goodbye"))
+	assert.Equal(t, nil, err)
+
+	time.Sleep(25 * time.Millisecond)
+	for _, ms := range []*MockSocket{ms1, ms2} {
+		assert.Equal(t, []string{"goodbye"}, ms.getPayloads())
+		assert.Equal(t, true, ms.getClosed())
+	}
+	assert.Equal(t, false, other.getClosed())
+}
+
+func TestBins(t *testing.T) {
+	sm := NewSocketMap(getUnsubFunc(t))
+	assert.Equal(t, []string{}, sm.Bins())
+
+	sm.Add("bin_name", "socket_uuid1", &MockSocket{name: "mock_socket1"})
+	sm.Add("bin_name", "socket_uuid2", &MockSocket{name: "mock_socket2"})
+	assert.Equal(t, []string{"bin_name"}, sm.Bins())
+}
+
 func getUnsubFunc(t *testing.T) unsubFunc {
 	us := func(channels ...string) error {
 		t.Error("Unexpected call to unsubscibe!")
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// how often the sqlite store sweeps out expired bins
+const sqliteSweepInterval = time.Minute
+
+// bin_usage keeps track of how much each bin holds, so that its retention limits can be
+// checked without going through all of its requests.
+//
+// The geo_bounds R-tree holds the bounding box of every Geo entry found in a request,
+// keyed by the id of its row in geos. Deleting a request cascades to its geos, and a
+// trigger keeps the R-tree in step.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS bins (
+	name    TEXT PRIMARY KEY,
+	expires INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS requests (
+	id   INTEGER PRIMARY KEY AUTOINCREMENT,
+	bin  TEXT NOT NULL REFERENCES bins(name) ON DELETE CASCADE,
+	ts   INTEGER NOT NULL,
+	body TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS requests_bin_ts ON requests (bin, ts);
+
+CREATE TABLE IF NOT EXISTS bin_usage (
+	bin      TEXT PRIMARY KEY REFERENCES bins(name) ON DELETE CASCADE,
+	requests INTEGER NOT NULL,
+	bytes    INTEGER NOT NULL,
+	dropped  INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS geos (
+	id         INTEGER PRIMARY KEY,
+	request_id INTEGER NOT NULL REFERENCES requests(id) ON DELETE CASCADE,
+	idx        INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS geos_request_id ON geos (request_id);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS geo_bounds USING rtree (
+	id,
+	min_lng, max_lng,
+	min_lat, max_lat
+);
+
+CREATE TRIGGER IF NOT EXISTS geos_delete AFTER DELETE ON geos BEGIN
+	DELETE FROM geo_bounds WHERE id = old.id;
+END;
+`
+
+// sqliteStore is a Store that keeps bins in a sqlite database. Each request's Geo
+// entries are indexed in an R-tree, which lets a bin's history be searched by location.
+type sqliteStore struct {
+	*memoryCounters
+	db   *sql.DB
+	done chan struct{}
+}
+
+// NewSQLiteStore opens (or creates) the sqlite database at path.
+func NewSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	ss := &sqliteStore{
+		memoryCounters: newMemoryCounters(),
+		db:             db,
+		done:           make(chan struct{}),
+	}
+
+	go ss.sweep(sqliteSweepInterval)
+	return ss, nil
+}
+
+func (ss *sqliteStore) CreateBin(name string, ttl time.Duration) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	live, err := sqliteBinIsLive(tx, name)
+	if err != nil {
+		return err
+	}
+
+	if live {
+		return errors.New("A bin by that id already exists.")
+	}
+
+	// clear out anything left behind by an expired bin of the same name
+	if _, err = tx.Exec(`DELETE FROM bins WHERE name = ?`, name); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`INSERT INTO bins (name, expires) VALUES (?, ?)`, name, time.Now().Add(ttl).UnixNano()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ss *sqliteStore) BinExists(name string) (bool, error) {
+	return sqliteBinIsLive(ss.db, name)
+}
+
+func (ss *sqliteStore) AddRequest(name string, ts int64, encoded string, r retention) (int64, error) {
+	// we only need the geo out of the encoded request, to fill the spatial index
+	var gr struct {
+		Geo []Geo `json:"geo"`
+	}
+	if err := json.Unmarshal([]byte(encoded), &gr); err != nil {
+		debugLog("Could not read geo from request, it will not be indexed:", err)
+	}
+
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	live, err := sqliteBinIsLive(tx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	if !live {
+		return 0, errBinNotFound
+	}
+
+	// bins created before usage was kept track of have theirs worked out from their requests
+	if _, err = tx.Exec(`INSERT OR IGNORE INTO bin_usage (bin, requests, bytes)
+		SELECT ?, COUNT(*), COALESCE(SUM(LENGTH(CAST(body AS BLOB))), 0) FROM requests WHERE bin = ?`, name, name); err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(`INSERT INTO requests (bin, ts, body) VALUES (?, ?, ?)`, name, ts, encoded)
+	if err != nil {
+		return 0, err
+	}
+
+	requestID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, g := range gr.Geo {
+		b, ok := geoBounds(g.Geo)
+		if !ok {
+			continue
+		}
+
+		res, err = tx.Exec(`INSERT INTO geos (request_id, idx) VALUES (?, ?)`, requestID, i)
+		if err != nil {
+			return 0, err
+		}
+
+		geoID, err := res.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(`INSERT INTO geo_bounds (id, min_lng, max_lng, min_lat, max_lat) VALUES (?, ?, ?, ?, ?)`,
+			geoID, b.MinLng, b.MaxLng, b.MinLat, b.MaxLat)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	dropped, err := sqliteTrim(tx, name, int64(len(encoded)), r)
+	if err != nil {
+		return 0, err
+	}
+
+	return dropped, tx.Commit()
+}
+
+func (ss *sqliteStore) History(name string) ([]string, error) {
+	return ss.queryHistory(name, `SELECT body FROM requests WHERE bin = ? ORDER BY ts DESC, id DESC`, name)
+}
+
+func (ss *sqliteStore) HistoryRange(name string, q historyQuery) ([]string, error) {
+	order := "DESC"
+	if q.Oldest {
+		order = "ASC"
+	}
+
+	// sqlite takes a negative limit to mean no limit
+	limit := q.Limit
+	if limit == 0 {
+		limit = -1
+	}
+
+	return ss.queryHistory(name, `SELECT body FROM requests WHERE bin = ? AND ts BETWEEN ? AND ?
+		ORDER BY ts `+order+`, id `+order+` LIMIT ? OFFSET ?`,
+		name, q.Since, q.Until, limit, q.Offset)
+}
+
+// HistoryWithin returns the encoded requests in a bin that have at least one Geo
+// entry whose bounding box intersects b, newest first.
+func (ss *sqliteStore) HistoryWithin(name string, b bbox) ([]string, error) {
+	return ss.queryHistory(name, `
+		SELECT body FROM requests WHERE id IN (
+			SELECT g.request_id FROM geos g JOIN geo_bounds gb ON gb.id = g.id
+			WHERE gb.max_lng >= ? AND gb.min_lng <= ? AND gb.max_lat >= ? AND gb.min_lat <= ?
+		) AND bin = ?
+		ORDER BY ts DESC, id DESC`,
+		b.MinLng, b.MaxLng, b.MinLat, b.MaxLat, name)
+}
+
+func (ss *sqliteStore) Count(name string) (int64, error) {
+	live, err := sqliteBinIsLive(ss.db, name)
+	if err != nil {
+		return 0, err
+	}
+
+	if !live {
+		return 0, errBinNotFound
+	}
+
+	var count int64
+	err = ss.db.QueryRow(`SELECT COUNT(*) FROM requests WHERE bin = ?`, name).Scan(&count)
+	return count, err
+}
+
+func (ss *sqliteStore) CountRange(name string, since, until int64) (int64, error) {
+	live, err := sqliteBinIsLive(ss.db, name)
+	if err != nil {
+		return 0, err
+	}
+
+	if !live {
+		return 0, errBinNotFound
+	}
+
+	var count int64
+	err = ss.db.QueryRow(`SELECT COUNT(*) FROM requests WHERE bin = ? AND ts BETWEEN ? AND ?`,
+		name, since, until).Scan(&count)
+	return count, err
+}
+
+func (ss *sqliteStore) Dropped(name string) (int64, error) {
+	live, err := sqliteBinIsLive(ss.db, name)
+	if err != nil {
+		return 0, err
+	}
+
+	if !live {
+		return 0, errBinNotFound
+	}
+
+	var dropped int64
+	err = ss.db.QueryRow(`SELECT dropped FROM bin_usage WHERE bin = ?`, name).Scan(&dropped)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return dropped, err
+}
+
+func (ss *sqliteStore) Expire(name string, ttl time.Duration) error {
+	res, err := ss.db.Exec(`UPDATE bins SET expires = ? WHERE name = ? AND expires > ?`,
+		time.Now().Add(ttl).UnixNano(), name, time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errBinNotFound
+	}
+	return nil
+}
+
+func (ss *sqliteStore) TTL(name string) (time.Duration, error) {
+	var expires int64
+	err := ss.db.QueryRow(`SELECT expires FROM bins WHERE name = ? AND expires > ?`,
+		name, time.Now().UnixNano()).Scan(&expires)
+	if err == sql.ErrNoRows {
+		return 0, errBinNotFound
+	} else if err != nil {
+		return 0, err
+	}
+
+	return time.Unix(0, expires).Sub(time.Now()), nil
+}
+
+func (ss *sqliteStore) DeleteBin(name string) error {
+	res, err := ss.db.Exec(`DELETE FROM bins WHERE name = ? AND expires > ?`, name, time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errBinNotFound
+	}
+	return nil
+}
+
+// Close stops the sweeper and closes the database.
+func (ss *sqliteStore) Close() error {
+	close(ss.done)
+	return ss.db.Close()
+}
+
+// queryHistory runs a query that selects request bodies from the named bin.
+func (ss *sqliteStore) queryHistory(name, query string, args ...interface{}) ([]string, error) {
+	live, err := sqliteBinIsLive(ss.db, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !live {
+		return nil, errBinNotFound
+	}
+
+	rows, err := ss.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]string, 0)
+	for rows.Next() {
+		var body string
+		if err := rows.Scan(&body); err != nil {
+			return nil, err
+		}
+		history = append(history, body)
+	}
+	return history, rows.Err()
+}
+
+// sweep periodically deletes expired bins from the database until the store is closed.
+func (ss *sqliteStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ss.done:
+			return
+		case now := <-ticker.C:
+			if err := ss.deleteExpired(now); err != nil {
+				log.Println("Failure to sweep expired bins:", err)
+			}
+			ss.memoryCounters.sweep(now)
+		}
+	}
+}
+
+// deleteExpired deletes every bin that expired before now, along with its requests.
+func (ss *sqliteStore) deleteExpired(now time.Time) error {
+	_, err := ss.db.Exec(`DELETE FROM bins WHERE expires <= ?`, now.UnixNano())
+	return err
+}
+
+// sqliteTrim adds a request of the given size to a bin's usage, then drops the bin's
+// oldest requests until it's back within r. It returns the number of requests dropped.
+func sqliteTrim(tx *sql.Tx, name string, size int64, r retention) (int64, error) {
+	if _, err := tx.Exec(`UPDATE bin_usage SET requests = requests + 1, bytes = bytes + ? WHERE bin = ?`,
+		size, name); err != nil {
+		return 0, err
+	}
+
+	var count, bytes, dropped int64
+	if err := tx.QueryRow(`SELECT requests, bytes FROM bin_usage WHERE bin = ?`, name).Scan(&count, &bytes); err != nil {
+		return 0, err
+	}
+
+	for ; r.exceeded(count, bytes); dropped++ {
+		var id, size int64
+		if err := tx.QueryRow(`SELECT id, LENGTH(CAST(body AS BLOB)) FROM requests WHERE bin = ? ORDER BY ts, id LIMIT 1`,
+			name).Scan(&id, &size); err != nil {
+			return 0, err
+		}
+
+		if _, err := tx.Exec(`DELETE FROM requests WHERE id = ?`, id); err != nil {
+			return 0, err
+		}
+		count--
+		bytes -= size
+	}
+
+	if dropped > 0 {
+		if _, err := tx.Exec(`UPDATE bin_usage SET requests = ?, bytes = ?, dropped = dropped + ? WHERE bin = ?`,
+			count, bytes, dropped, name); err != nil {
+			return 0, err
+		}
+	}
+	return dropped, nil
+}
+
+// sqliteQueryer is satisfied by both *sql.DB and *sql.Tx.
+type sqliteQueryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// sqliteBinIsLive returns true if the named bin exists and has not yet expired.
+func sqliteBinIsLive(q sqliteQueryer, name string) (bool, error) {
+	var live bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM bins WHERE name = ? AND expires > ?)`,
+		name, time.Now().UnixNano()).Scan(&live)
+	return live, err
+}
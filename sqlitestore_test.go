@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestSQLiteStoreBins(t *testing.T) {
+	path, cleanup := tempDBPath(t)
+	defer cleanup()
+
+	ss, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	assert.Equal(t, errBinNotFound, addRequest(ss, "bin_name", 1, "{}"))
+	assert.Equal(t, nil, ss.CreateBin("bin_name", time.Hour))
+	assert.NotEqual(t, nil, ss.CreateBin("bin_name", time.Hour))
+
+	history, err := ss.History("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{}, history)
+
+	assert.Equal(t, nil, addRequest(ss, "bin_name", 2, "two"))
+	assert.Equal(t, nil, addRequest(ss, "bin_name", 1, "one"))
+	assert.Equal(t, nil, addRequest(ss, "bin_name", 2, "two again"))
+
+	history, err = ss.History("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"two again", "two", "one"}, history)
+
+	count, err := ss.Count("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(3), count)
+
+	_, err = ss.Count("unknown_bin_name")
+	assert.Equal(t, errBinNotFound, err)
+
+	assert.Equal(t, nil, ss.DeleteBin("bin_name"))
+	assert.Equal(t, errBinNotFound, ss.DeleteBin("bin_name"))
+	exists, err := ss.BinExists("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, exists)
+}
+
+func TestSQLiteStoreExpire(t *testing.T) {
+	path, cleanup := tempDBPath(t)
+	defer cleanup()
+
+	ss, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	assert.Equal(t, nil, ss.CreateBin("expired", time.Hour))
+	assert.Equal(t, nil, addRequest(ss, "expired", 1, sqliteTestRequest(t, 1, 1)))
+	assert.Equal(t, nil, ss.Expire("expired", -time.Second))
+	assert.Equal(t, errBinNotFound, ss.Expire("expired", time.Hour))
+
+	exists, err := ss.BinExists("expired")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, exists)
+
+	// sweeping should remove the bin's requests and their spatial index entries too
+	assert.Equal(t, nil, ss.deleteExpired(time.Now()))
+	var n int
+	assert.Equal(t, nil, ss.db.QueryRow(`SELECT COUNT(*) FROM geo_bounds`).Scan(&n))
+	assert.Equal(t, 0, n)
+
+	assert.Equal(t, nil, ss.CreateBin("expired", time.Hour))
+	count, err := ss.Count("expired")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestSQLiteStoreHistoryWithin(t *testing.T) {
+	path, cleanup := tempDBPath(t)
+	defer cleanup()
+
+	ss, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	portland := sqliteTestRequest(t, -122.68, 45.52)
+	seattle := sqliteTestRequest(t, -122.33, 47.61)
+	assert.Equal(t, nil, ss.CreateBin("bin_name", time.Hour))
+	assert.Equal(t, nil, addRequest(ss, "bin_name", 1, portland))
+	assert.Equal(t, nil, addRequest(ss, "bin_name", 2, seattle))
+	assert.Equal(t, nil, addRequest(ss, "bin_name", 3, `{"body": "no geo here"}`))
+
+	history, err := ss.HistoryWithin("bin_name", bbox{-123, 45, -122, 46})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{portland}, history)
+
+	history, err = ss.HistoryWithin("bin_name", bbox{-123, 45, -122, 48})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{seattle, portland}, history)
+
+	// the fallback used by the other stores should find the same things
+	ms := NewMemoryStore()
+	assert.Equal(t, nil, ms.CreateBin("bin_name", time.Hour))
+	assert.Equal(t, nil, addRequest(ms, "bin_name", 1, portland))
+	assert.Equal(t, nil, addRequest(ms, "bin_name", 2, seattle))
+	history, err = historyWithin(ms, "bin_name", bbox{-123, 45, -122, 46})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{portland}, history)
+
+	_, err = ss.HistoryWithin("unknown_bin_name", bbox{-180, -90, 180, 90})
+	assert.Equal(t, errBinNotFound, err)
+}
+
+func sqliteTestRequest(t *testing.T, lng, lat float64) string {
+	body, _ := json.Marshal(map[string]float64{"lng": lng, "lat": lat})
+	encoded, err := json.Marshal(NewGeobinRequest(0, nil, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(encoded)
+}
@@ -0,0 +1,85 @@
+package main
+
+import "math"
+
+// The lengths of the feet that state plane coordinates are given in, in meters. Most states use
+// the US survey foot, but a few, such as Oregon, use the international foot.
+const (
+	usSurveyFoot      = 1200.0 / 3937
+	internationalFoot = 0.3048
+)
+
+// lambertConformalConic is a Lambert conformal conic projection with two standard parallels,
+// which is what most state plane zones use. Angles are in degrees, and the false easting and
+// northing in meters.
+type lambertConformalConic struct {
+	// the standard parallels, and the latitude and longitude of the false origin
+	lat1, lat2, lat0, lng0 float64
+	falseEasting           float64
+	falseNorthing          float64
+	// the length of the unit that coordinates are given in, in meters
+	unit float64
+}
+
+// statePlanes are the state plane zones we know how to convert to WGS84, keyed by SRID, in
+// meters and in the feet each state uses. They're defined on NAD83, which is close enough to
+// WGS84 for drawing on a map that we treat them as the same.
+var statePlanes = map[int]lambertConformalConic{
+	// NAD83 / California zone 3
+	26943: {38 + 26.0/60, 37 + 4.0/60, 36.5, -120.5, 2000000, 500000, 1},
+	2227:  {38 + 26.0/60, 37 + 4.0/60, 36.5, -120.5, 2000000, 500000, usSurveyFoot},
+	// NAD83 / New York Long Island
+	32118: {41 + 2.0/60, 40 + 40.0/60, 40 + 10.0/60, -74, 300000, 0, 1},
+	2263:  {41 + 2.0/60, 40 + 40.0/60, 40 + 10.0/60, -74, 300000, 0, usSurveyFoot},
+	// NAD83 / Oregon North, and the same on NAD83(HARN)
+	32126: {46, 44 + 20.0/60, 43 + 40.0/60, -120.5, 2500000, 0, 1},
+	2269:  {46, 44 + 20.0/60, 43 + 40.0/60, -120.5, 2500000, 0, internationalFoot},
+	2913:  {46, 44 + 20.0/60, 43 + 40.0/60, -120.5, 2500000, 0, internationalFoot},
+	// NAD83 / Texas Central
+	32139: {31 + 53.0/60, 30 + 7.0/60, 29 + 40.0/60, -100 - 20.0/60, 700000, 3000000, 1},
+	2277:  {31 + 53.0/60, 30 + 7.0/60, 29 + 40.0/60, -100 - 20.0/60, 700000, 3000000, usSurveyFoot},
+	// NAD83 / Washington North
+	32148: {48 + 44.0/60, 47.5, 47, -120 - 50.0/60, 500000, 0, 1},
+	2285:  {48 + 44.0/60, 47.5, 47, -120 - 50.0/60, 500000, 0, usSurveyFoot},
+}
+
+// toWGS84 converts an easting and northing in the projection to WGS84 longitude and latitude,
+// using the ellipsoidal formulas in Snyder's Map Projections: A Working Manual.
+func (p lambertConformalConic) toWGS84(x, y float64) (float64, float64) {
+	e := math.Sqrt(wgs84F * (2 - wgs84F))
+	rad := math.Pi / 180
+
+	m := func(lat float64) float64 {
+		s := math.Sin(lat)
+		return math.Cos(lat) / math.Sqrt(1-e*e*s*s)
+	}
+	t := func(lat float64) float64 {
+		s := math.Sin(lat)
+		return math.Tan(math.Pi/4-lat/2) / math.Pow((1-e*s)/(1+e*s), e/2)
+	}
+
+	lat1, lat2 := p.lat1*rad, p.lat2*rad
+	n := (math.Log(m(lat1)) - math.Log(m(lat2))) / (math.Log(t(lat1)) - math.Log(t(lat2)))
+	f := m(lat1) / (n * math.Pow(t(lat1), n))
+	rho0 := wgs84A * f * math.Pow(t(p.lat0*rad), n)
+
+	dx := x*p.unit - p.falseEasting
+	dy := rho0 - (y*p.unit - p.falseNorthing)
+	rho := math.Copysign(math.Hypot(dx, dy), n)
+	theta := math.Atan2(math.Copysign(1, n)*dx, math.Copysign(1, n)*dy)
+	tp := math.Pow(rho/(wgs84A*f), 1/n)
+
+	// the latitude is found by iterating until it settles, which takes a handful of steps
+	lat := math.Pi/2 - 2*math.Atan(tp)
+	for i := 0; i < 15; i++ {
+		s := math.Sin(lat)
+		next := math.Pi/2 - 2*math.Atan(tp*math.Pow((1-e*s)/(1+e*s), e/2))
+		if math.Abs(next-lat) < 1e-12 {
+			lat = next
+			break
+		}
+		lat = next
+	}
+
+	return p.lng0 + theta/n/rad, lat / rad
+}
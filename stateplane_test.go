@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestStatePlaneToWGS84(t *testing.T) {
+	for _, test := range []struct {
+		srid     int
+		x, y     float64
+		lng, lat float64
+	}{
+		// the false origin of California zone 3
+		{26943, 2000000, 500000, -120.5, 36.5},
+		// Portland, in international feet
+		{2913, 7643409.380, 683217.120, -122.68, 45.52},
+		// Times Square, in US survey feet
+		{2263, 988267.074, 215436.879, -73.9855, 40.758},
+		// Austin, in meters
+		{32139, 949218.049, 3069475.072, -97.7431, 30.2672},
+	} {
+		lng, lat := statePlanes[test.srid].toWGS84(test.x, test.y)
+		assertNear(t, []float64{test.lng, test.lat}, []float64{lng, lat}, 1e-7)
+	}
+}
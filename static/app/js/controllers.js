@@ -36,7 +36,7 @@
   }])
 
   // Bin controller
-  .controller('BinCtrl', ['$scope', '$stateParams', '$location', 'api', function ($scope, $stateParams, $location, api) {
+  .controller('BinCtrl', ['$scope', '$stateParams', '$location', 'api', 'store', function ($scope, $stateParams, $location, api, store) {
     var binId = $scope.binId = $stateParams.binId;
     document.title = 'Geobin | ' + binId;
     $scope.host = window.location.host;
@@ -87,10 +87,87 @@
       $scope.zoomToAll();
     });
 
+    // add any requests from the server's history that we don't already have
+    $scope.backfill = function () {
+      api.history(binId, function (data) {
+        if (!data || !$scope.history) {
+          return;
+        }
+
+        var seen = {};
+        for (var i = 0; i < $scope.history.length; i++) {
+          seen[$scope.history[i].timestamp + $scope.history[i].body] = true;
+        }
+
+        data.reverse();
+        for (var j = 0; j < data.length; j++) {
+          if (!seen[data[j].timestamp + data[j].body]) {
+            $scope.history.push(data[j]);
+            $scope.toggleGeo(data[j]);
+          }
+        }
+      });
+    };
+
+    // events tell us about the bin itself rather than a request to it, and are told apart
+    // from requests by their "event" key
+    $scope.handleEvent = function (data) {
+      switch (data.event) {
+        case 'reconnected':
+          if (data.missed > 0) {
+            $scope.backfill();
+          }
+          break;
+        case 'expiry':
+          var bins = store.local.session.history;
+          for (var i = 0; i < bins.length; i++) {
+            if (bins[i].id === binId) {
+              bins[i].expires = data.expires;
+            }
+          }
+          store.local.save();
+          $scope.expiresSoon = false;
+          break;
+        case 'expiring':
+          $scope.expiresSoon = data.expires;
+          break;
+        case 'dropped':
+          // history is oldest first, so the dropped requests are at the start of it
+          if ($scope.history) {
+            var gone = $scope.history.splice(0, data.dropped);
+            for (var k = 0; k < gone.length; k++) {
+              if ($scope.visibleLayers[gone[k].timestamp]) {
+                $scope.toggleGeo(gone[k]);
+              }
+            }
+          }
+          break;
+        case 'deleted':
+        case 'expired':
+          var remaining = store.local.session.history;
+          for (var j = remaining.length - 1; j >= 0; j--) {
+            if (remaining[j].id === binId) {
+              remaining.splice(j, 1);
+            }
+          }
+          store.local.save();
+          $scope.validBin = false;
+          $scope.history = false;
+          $scope.expiresSoon = false;
+          break;
+      }
+    };
+
     api.ws.open(binId, function(event) {
       $scope.isNew = true;
       try {
         var data = JSON.parse(event.data);
+        if (data.event) {
+          $scope.$apply(function(){
+            $scope.handleEvent(data);
+          });
+          return;
+        }
         $scope.$apply(function(){
           $scope.history.push(data);
           $scope.toggleGeo(data);
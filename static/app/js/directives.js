@@ -69,12 +69,17 @@
           var color, layer;
           var id = item.timestamp;
           var arr = item.geo;
-          var body = JSON.parse(item.body);
+          var body = parseBody(item.body);
 
           if (!features[id]) {
             features[id] = L.featureGroup();
 
             for (var i = 0, len = arr.length; i < len; i++) {
+              // geo in a coordinate system we couldn't convert can't be drawn
+              if (arr[i].untransformed) {
+                continue;
+              }
+
               layer = createLayer(arr[i], body);
               features[id].addLayer(layer);
             }
@@ -142,19 +147,21 @@
             clickable: true
           };
 
+          // geojson with problems is still drawn, but dashed so that it stands out
+          if (obj.diagnostics) {
+            shapeOptions.dashArray = '5, 5';
+          }
+
           if (obj.radius) {
+            // points found in CSV bodies are features, so that they can keep the other columns
+            var point = obj.geo.type === 'Feature' ? obj.geo.geometry : obj.geo;
             layer = L.circle(
-              obj.geo.coordinates.reverse(),
+              point.coordinates.slice().reverse(),
               obj.radius,
               shapeOptions
             );
 
-            if (obj.path.length) {
-              content = valueFromPath(body, obj.path);
-            } else {
-              content = body;
-            }
-
+            content = withDiagnostics(popupContent(obj, body), obj);
             layer.bindPopup('<pre>' + JSON.stringify(content, undefined, 2) + '</pre>');
           } else {
             layer = L.geoJson(obj.geo, {
@@ -162,13 +169,12 @@
                 return shapeOptions;
               },
               onEachFeature: function (feature, layer) {
-                if (body.type === 'FeatureCollection') {
+                if (body && body.type === 'FeatureCollection') {
                   content = feature;
-                } else if (obj.path.length) {
-                  content = valueFromPath(body, obj.path);
                 } else {
-                  content = body;
+                  content = popupContent(obj, body);
                 }
+                content = withDiagnostics(content, obj);
                 layer.bindPopup('<pre>' + JSON.stringify(content, undefined, 2) + '</pre>');
               }
             });
@@ -203,6 +209,57 @@
     return str.substr(0, index) + c + str.substr(index + 1);
   }
 
+  /**
+   * parse a request body as JSON
+   * @param  {String} str - request body
+   * @return {Object} parsed body, or null if the body isn't JSON (GPX, for example)
+   */
+  function parseBody (str) {
+    try {
+      return JSON.parse(str);
+    } catch (e) {
+      return null;
+    }
+  }
+
+  /**
+   * get the content to show in a geo object's popup
+   * @param  {Object} obj - geo object from a geobin request object
+   * @param  {Object} body - parsed request body, or null if it isn't JSON
+   * @return {Object} popup content
+   */
+  function popupContent (obj, body) {
+    // bodies that aren't JSON can't be looked into, so show what we know about the geo instead
+    if (!body) {
+      return {
+        path: obj.path.join('/'),
+        properties: obj.geo.properties
+      };
+    }
+
+    if (obj.path.length) {
+      return valueFromPath(body, obj.path);
+    }
+    return body;
+  }
+
+  /**
+   * add the problems found with a geo object's geojson to its popup content
+   * @param  {Object} content - popup content
+   * @param  {Object} obj - geo object from a geobin request object
+   * @return {Object} popup content, with the diagnostics if there are any
+   */
+  function withDiagnostics (content, obj) {
+    if (!obj.diagnostics) {
+      return content;
+    }
+
+    return {
+      geo: content,
+      diagnostics: obj.diagnostics
+    };
+  }
+
   function valueFromPath (obj, arr) {
     var a = arr.slice(0);
     var k = a.shift();
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// errBinNotFound is returned by a Store when asked about a bin it doesn't have.
+var errBinNotFound = errors.New("No bin by that id.")
+
+// noExpiry is the TTL of a bin that never expires. Geobin always gives bins a lifetime, so
+// this only happens when something else has taken it away, such as PERSIST in redis.
+const noExpiry time.Duration = -1
+
+// Store persists bins and the requests that are posted to them. Implementations
+// are selected with the "Store" key in config.json.
+type Store interface {
+	// CreateBin creates a new, empty bin that expires after ttl.
+	CreateBin(name string, ttl time.Duration) error
+	// BinExists reports whether or not a bin with the given name exists.
+	BinExists(name string) (bool, error)
+	// AddRequest appends an encoded GeobinRequest received at ts (Unix time) to a bin.
+	// If that takes the bin over the limits in r, its oldest requests are dropped in
+	// the same operation, and the number dropped is returned.
+	AddRequest(name string, ts int64, encoded string, r retention) (int64, error)
+	// History returns all of the encoded requests stored in a bin, newest first.
+	History(name string) ([]string, error)
+	// HistoryRange returns the encoded requests in a bin that are selected by q.
+	HistoryRange(name string, q historyQuery) ([]string, error)
+	// Count returns the number of requests stored in a bin.
+	Count(name string) (int64, error)
+	// CountRange returns the number of requests in a bin that were received between
+	// since and until (Unix time, inclusive).
+	CountRange(name string, since, until int64) (int64, error)
+	// Dropped returns the number of requests that have been dropped from a bin to keep
+	// it within its retention limits.
+	Dropped(name string) (int64, error)
+	// Expire sets a bin to expire after ttl.
+	Expire(name string, ttl time.Duration) error
+	// TTL returns how long a bin has left before it expires, or noExpiry if it never
+	// will. It returns errBinNotFound if there is no such bin.
+	TTL(name string) (time.Duration, error)
+	// DeleteBin deletes a bin and everything in it.
+	DeleteBin(name string) error
+	// Incr increments the counter at key, creating it with the given ttl if it
+	// does not already exist, and returns the new value.
+	Incr(key string, ttl time.Duration) (int64, error)
+}
+
+// retention limits how much a bin can hold. When a request takes a bin over either
+// limit, the bin's oldest requests are dropped until it's back under, although the
+// last request in a bin is never dropped. Limits of zero or less are no limit at all.
+type retention struct {
+	// the most requests a bin can hold
+	MaxRequests int64
+	// the most bytes of encoded requests a bin can hold
+	MaxBytes int64
+}
+
+// exceeded reports whether a bin holding count requests totalling size bytes is over
+// the limits, and should have a request dropped.
+func (r retention) exceeded(count, size int64) bool {
+	if count <= 1 {
+		return false
+	}
+	return (r.MaxRequests > 0 && count > r.MaxRequests) || (r.MaxBytes > 0 && size > r.MaxBytes)
+}
+
+// SpatialStore is implemented by Stores that can search a bin's history by location.
+type SpatialStore interface {
+	// HistoryWithin returns the encoded requests in a bin that have at least one Geo
+	// entry whose bounding box intersects b, newest first.
+	HistoryWithin(name string, b bbox) ([]string, error)
+}
+
+// historyWithin searches a bin's history by location, using the Store's spatial index
+// if it has one, or by checking every request in the bin if it doesn't.
+func historyWithin(st Store, name string, b bbox) ([]string, error) {
+	if ss, ok := st.(SpatialStore); ok {
+		return ss.HistoryWithin(name, b)
+	}
+
+	history, err := st.History(name)
+	if err != nil {
+		return nil, err
+	}
+
+	within := make([]string, 0)
+	for _, h := range history {
+		var gr struct {
+			Geo []Geo `json:"geo"`
+		}
+		if err := json.Unmarshal([]byte(h), &gr); err != nil {
+			continue
+		}
+
+		for _, g := range gr.Geo {
+			if gb, ok := geoBounds(g.Geo); ok && gb.intersects(b) {
+				within = append(within, h)
+				break
+			}
+		}
+	}
+	return within, nil
+}
+
+// backend bundles together the Store and PubSubber selected by the config along
+// with the means to run and shut them down.
+type backend struct {
+	Store
+	PubSubber
+	// pump forwards published messages on to the sockets in the given SocketMap.
+	// It blocks for as long as the backend is running.
+	pump func(SocketMap)
+	// close releases any connections held by the backend.
+	close func()
+}
+
+// newBackend creates the backend named by conf.Store.
+func newBackend(conf *Config) (*backend, error) {
+	switch conf.Store {
+	case storeRedis:
+		return newRedisBackend(conf)
+	case storeMemory:
+		return newMemoryBackend(), nil
+	case storeBolt:
+		return newBoltBackend(conf)
+	case storeSQLite:
+		return newSQLiteBackend(conf)
+	default:
+		return nil, errors.New("Unknown store: " + conf.Store)
+	}
+}
+
+// newRedisClient connects to the redis server described in conf.
+func newRedisClient(conf *Config) (*redis.Client, error) {
+	client := redis.NewTCPClient(&redis.Options{
+		Addr:     conf.RedisHost,
+		Password: conf.RedisPass,
+		DB:       conf.RedisDB,
+	})
+
+	if ping := client.Ping(); ping.Err() != nil {
+		client.Close()
+		return nil, ping.Err()
+	}
+
+	return client, nil
+}
+
+// newRedisBackend connects to the redis server described in conf.
+func newRedisBackend(conf *Config) (*backend, error) {
+	client, err := newRedisClient(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// redis pubsub connection
+	ps := NewRedisPubSub(client)
+	rs := &redisStore{NewRedisWrapper(client)}
+
+	// ask redis to tell us when bins expire. The expiry watcher will still notice
+	// expired bins if this doesn't work, just not as quickly.
+	expiredChannel := fmt.Sprintf("__keyevent@%d__:expired", conf.RedisDB)
+	if err = enableExpiredEvents(client); err != nil {
+		log.Println("Failure to enable Redis keyspace notifications:", err)
+	}
+	if err = ps.Subscribe(expiredChannel); err != nil {
+		ps.Close()
+		client.Close()
+		return nil, err
+	}
+
+	return &backend{
+		Store:     rs,
+		PubSubber: ps,
+		pump: func(sm SocketMap) {
+			redisPump(ps, expiredChannel, rs.CountSince, sm)
+		},
+		close: func() {
+			ps.Close()
+			client.Close()
+		},
+	}, nil
+}
+
+// enableExpiredEvents turns on redis keyspace notifications for expired keys. Other clients of
+// the same server may rely on other notifications, so the flags already set are kept.
+func enableExpiredEvents(client *redis.Client) error {
+	v, err := client.ConfigGet("notify-keyspace-events").Result()
+	if err != nil {
+		return err
+	}
+
+	// the reply is the name of the setting followed by its value
+	var flags string
+	if len(v) == 2 {
+		flags, _ = v[1].(string)
+	}
+
+	if merged := withExpiredEvents(flags); merged != flags {
+		return client.ConfigSet("notify-keyspace-events", merged).Err()
+	}
+	return nil
+}
+
+// withExpiredEvents adds the flags for keyevent notifications (E) of expired keys (x) to the
+// given notify-keyspace-events flags, if they aren't there already. A stands for all of the
+// kinds of key event, x included.
+func withExpiredEvents(flags string) string {
+	if !strings.Contains(flags, "E") {
+		flags += "E"
+	}
+	if !strings.ContainsAny(flags, "xA") {
+		flags += "x"
+	}
+	return flags
+}
+
+// newMemoryBackend creates a backend that keeps everything in process memory.
+func newMemoryBackend() *backend {
+	ps := NewMemoryPubSub()
+	return &backend{
+		Store:     NewMemoryStore(),
+		PubSubber: ps,
+		pump: func(sm SocketMap) {
+			memoryPump(ps, sm)
+		},
+		close: func() {},
+	}
+}
+
+// newBoltBackend opens the bolt database file at conf.BoltPath. Since everything
+// runs in a single process, published messages are delivered in memory.
+func newBoltBackend(conf *Config) (*backend, error) {
+	bs, err := NewBoltStore(conf.BoltPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := NewMemoryPubSub()
+	return &backend{
+		Store:     bs,
+		PubSubber: ps,
+		pump: func(sm SocketMap) {
+			memoryPump(ps, sm)
+		},
+		close: func() {
+			bs.Close()
+		},
+	}, nil
+}
+
+// newSQLiteBackend opens the sqlite database file at conf.SQLitePath. Since everything
+// runs in a single process, published messages are delivered in memory.
+func newSQLiteBackend(conf *Config) (*backend, error) {
+	ss, err := NewSQLiteStore(conf.SQLitePath)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := NewMemoryPubSub()
+	return &backend{
+		Store:     ss,
+		PubSubber: ps,
+		pump: func(sm SocketMap) {
+			memoryPump(ps, sm)
+		},
+		close: func() {
+			ss.Close()
+		},
+	}, nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+	"github.com/go-redis/redis"
+)
+
+// addRequest adds a request to a bin without any retention limits, for tests that
+// don't care about trimming.
+func addRequest(st Store, name string, ts int64, encoded string) error {
+	_, err := st.AddRequest(name, ts, encoded, retention{})
+	return err
+}
+
+func TestRetentionExceeded(t *testing.T) {
+	r := retention{MaxRequests: 2, MaxBytes: 10}
+	assert.Equal(t, false, r.exceeded(2, 10))
+	assert.Equal(t, true, r.exceeded(3, 10))
+	assert.Equal(t, true, r.exceeded(2, 11))
+
+	// the last request is always kept
+	assert.Equal(t, false, r.exceeded(1, 100))
+	assert.Equal(t, false, retention{}.exceeded(1000, 1000))
+}
+
+func TestMemoryStoreRetention(t *testing.T) {
+	testRetention(t, NewMemoryStore())
+}
+
+func TestBoltStoreRetention(t *testing.T) {
+	path, cleanup := tempDBPath(t)
+	defer cleanup()
+
+	bs, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bs.Close()
+
+	testRetention(t, bs)
+}
+
+func TestSQLiteStoreRetention(t *testing.T) {
+	path, cleanup := tempDBPath(t)
+	defer cleanup()
+
+	ss, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	testRetention(t, ss)
+}
+
+func TestRedisStoreRetention(t *testing.T) {
+	testRetention(t, NewRedisStore(NewMockRedis()))
+}
+
+func TestRedisStoreTTL(t *testing.T) {
+	mr := NewMockRedis()
+	rs := NewRedisStore(mr)
+
+	_, err := rs.TTL("missing")
+	assert.Equal(t, errBinNotFound, err)
+
+	assert.Equal(t, nil, rs.CreateBin("bin_name", time.Hour))
+	ttl, err := rs.TTL("bin_name")
+	assert.Equal(t, nil, err)
+	assert.T(t, ttl > 59*time.Minute && ttl <= time.Hour, ttl)
+
+	// a bin that has lost its expiration somehow never expires
+	_, err = mr.ZAdd("persisted", redis.Z{Score: 0, Member: ""})
+	assert.Equal(t, nil, err)
+	ttl, err = rs.TTL("persisted")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, noExpiry, ttl)
+
+	// and one that has run out of time is gone
+	assert.Equal(t, nil, rs.Expire("bin_name", -time.Second))
+	_, err = rs.TTL("bin_name")
+	assert.Equal(t, errBinNotFound, err)
+}
+
+func TestRedisStoreExpire(t *testing.T) {
+	rs := NewRedisStore(NewMockRedis())
+	assert.Equal(t, errBinNotFound, rs.Expire("missing", time.Hour))
+
+	// a bin nothing has been posted to has no usage hash yet
+	assert.Equal(t, nil, rs.CreateBin("bin_name", time.Hour))
+	assert.Equal(t, nil, rs.Expire("bin_name", -time.Second))
+
+	exists, err := rs.BinExists("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, exists)
+	assert.Equal(t, errBinNotFound, rs.Expire("bin_name", time.Hour))
+}
+
+func TestWithExpiredEvents(t *testing.T) {
+	assert.Equal(t, "Ex", withExpiredEvents(""))
+	assert.Equal(t, "KgEx", withExpiredEvents("Kg"))
+	assert.Equal(t, "KEA", withExpiredEvents("KEA"))
+	assert.Equal(t, "Ex", withExpiredEvents("Ex"))
+}
+
+// testRetention fills a bin past its limits, checking that the oldest requests are dropped.
+func testRetention(t *testing.T, st Store) {
+	_, err := st.AddRequest("bin_name", 1, "request 1", retention{})
+	assert.Equal(t, errBinNotFound, err)
+
+	assert.Equal(t, nil, st.CreateBin("bin_name", time.Hour))
+	r := retention{MaxRequests: 3, MaxBytes: 40}
+	for i := 1; i <= 3; i++ {
+		dropped, err := st.AddRequest("bin_name", int64(i), fmt.Sprintf("request %d", i), r)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, int64(0), dropped)
+	}
+
+	// too many requests
+	dropped, err := st.AddRequest("bin_name", 4, "request 4", r)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(1), dropped)
+
+	// too many bytes
+	dropped, err = st.AddRequest("bin_name", 5, "request 5 is much, much longer", r)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(2), dropped)
+
+	history, err := st.History("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"request 5 is much, much longer", "request 4"}, history)
+
+	total, err := st.Dropped("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(3), total)
+
+	// a request that's over the limit on its own is still kept
+	dropped, err = st.AddRequest("bin_name", 6, "request 6 is a lot longer than the byte limit", r)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(2), dropped)
+
+	count, err := st.Count("bin_name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestRedisStoreBins(t *testing.T) {
+	rs := NewRedisStore(NewMockRedis())
+
+	// enough bins to take a few SCANs, along with keys that aren't bins
+	for i := 0; i < 250; i++ {
+		assert.Equal(t, nil, rs.CreateBin(fmt.Sprintf("bin%d", i), time.Hour))
+	}
+	assert.Equal(t, nil, addRequest(rs, "bin0", 1, "one"))
+	_, err := rs.Incr("rate-limit:/bin0:1", time.Second)
+	assert.Equal(t, nil, err)
+
+	bins, err := rs.(*redisStore).Bins()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 250, len(bins))
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"sort"
+)
+
+var errInvalidTopology = errors.New("invalid TopoJSON topology")
+
+// topology decodes the geometries in a TopoJSON Topology.
+type topology struct {
+	// the topology's arcs, with any quantization already undone
+	arcs [][]interface{}
+	// the quantization transform, if there is one
+	scale, translate [2]float64
+	quantized        bool
+}
+
+// topojsonGeos decodes a TopoJSON Topology into GeoJSON Features, one for each of the objects in
+// it. The path of each is ["objects", name]. A GeometryCollection object becomes a Feature for each
+// of its geometries instead, with paths of ["objects", name, "geometries", index]. It returns false
+// if the map isn't a Topology.
+func topojsonGeos(o map[string]interface{}, kp []interface{}) ([]Geo, bool) {
+	if o["type"] != "Topology" {
+		return nil, false
+	}
+
+	objects, ok := o["objects"].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	t, err := newTopology(o)
+	if err != nil {
+		debugLog("Couldn't decode topology:", err)
+		return nil, false
+	}
+
+	// go through the objects in order so that the geos always come out the same way
+	names := make([]string, 0, len(objects))
+	for name := range objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	geos := make([]Geo, 0)
+	add := func(obj map[string]interface{}, path []interface{}) {
+		geometry, err := t.geometry(obj)
+		if err != nil {
+			debugLog("Couldn't decode topology object at", path, err)
+			return
+		}
+		if geometry == nil {
+			return
+		}
+
+		g := Geo{Path: path}
+		if err := g.project(geometry, 0); err != nil {
+			debugLog("Invalid topology coordinates at", path, err)
+			return
+		}
+
+		props, _ := obj["properties"].(map[string]interface{})
+		f := newFeature(geometry, props)
+		if id, ok := obj["id"]; ok {
+			f["id"] = id
+		}
+		g.Geo = f
+		geos = append(geos, g)
+	}
+
+	for _, name := range names {
+		obj, ok := objects[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		path := appendPath(kp, "objects", name)
+		if obj["type"] != "GeometryCollection" {
+			add(obj, path)
+			continue
+		}
+
+		members, _ := obj["geometries"].([]interface{})
+		for i, m := range members {
+			if member, ok := m.(map[string]interface{}); ok {
+				add(member, appendPath(path, "geometries", i))
+			}
+		}
+	}
+	return geos, true
+}
+
+// newTopology reads the transform and arcs of a Topology, undoing the delta encoding and
+// quantization of the arcs.
+func newTopology(o map[string]interface{}) (*topology, error) {
+	t := &topology{}
+	if tr, ok := o["transform"].(map[string]interface{}); ok {
+		scale, ok1 := topojsonPair(tr["scale"])
+		translate, ok2 := topojsonPair(tr["translate"])
+		if !ok1 || !ok2 {
+			return nil, errInvalidTopology
+		}
+		t.scale, t.translate, t.quantized = scale, translate, true
+	}
+
+	arcs, _ := o["arcs"].([]interface{})
+	t.arcs = make([][]interface{}, len(arcs))
+	for i, a := range arcs {
+		points, ok := a.([]interface{})
+		if !ok {
+			return nil, errInvalidTopology
+		}
+
+		arc := make([]interface{}, len(points))
+		var x, y float64
+		for j, p := range points {
+			pos, ok := topojsonPosition(p)
+			if !ok {
+				return nil, errInvalidTopology
+			}
+
+			if t.quantized {
+				x, y = x+pos[0].(float64), y+pos[1].(float64)
+				pos[0], pos[1] = t.untransform(x, y)
+			}
+			arc[j] = pos
+		}
+		t.arcs[i] = arc
+	}
+	return t, nil
+}
+
+func (t *topology) untransform(x, y float64) (float64, float64) {
+	return x*t.scale[0] + t.translate[0], y*t.scale[1] + t.translate[1]
+}
+
+// geometry decodes a TopoJSON geometry object into a GeoJSON geometry, or nil for a geometry
+// object with a null type.
+func (t *topology) geometry(obj map[string]interface{}) (map[string]interface{}, error) {
+	var coords interface{}
+	var err error
+	switch typ := obj["type"]; typ {
+	case nil:
+		return nil, nil
+	case "Point":
+		coords, err = t.point(obj["coordinates"])
+	case "MultiPoint":
+		coords, err = t.each(obj["coordinates"], t.point)
+	case "LineString":
+		coords, err = t.line(obj["arcs"])
+	case "MultiLineString", "Polygon":
+		coords, err = t.each(obj["arcs"], t.line)
+	case "MultiPolygon":
+		coords, err = t.each(obj["arcs"], func(v interface{}) (interface{}, error) {
+			return t.each(v, t.line)
+		})
+	case "GeometryCollection":
+		members, _ := obj["geometries"].([]interface{})
+		geoms := make([]interface{}, 0, len(members))
+		for _, m := range members {
+			member, ok := m.(map[string]interface{})
+			if !ok {
+				return nil, errInvalidTopology
+			}
+
+			g, err := t.geometry(member)
+			if err != nil {
+				return nil, err
+			}
+			if g != nil {
+				geoms = append(geoms, g)
+			}
+		}
+		return map[string]interface{}{"type": typ, "geometries": geoms}, nil
+	default:
+		return nil, errInvalidTopology
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newGeometry(obj["type"].(string), coords), nil
+}
+
+// point decodes the position of a Point, which isn't delta encoded even when it's quantized.
+func (t *topology) point(v interface{}) (interface{}, error) {
+	pos, ok := topojsonPosition(v)
+	if !ok {
+		return nil, errInvalidTopology
+	}
+
+	if t.quantized {
+		pos[0], pos[1] = t.untransform(pos[0].(float64), pos[1].(float64))
+	}
+	return pos, nil
+}
+
+// line stitches together the arcs with the given indexes into a line or ring. A negative index
+// ~i means arc i reversed. Each arc starts where the one before it ended, so that position is
+// only kept once.
+func (t *topology) line(v interface{}) (interface{}, error) {
+	indexes, ok := v.([]interface{})
+	if !ok {
+		return nil, errInvalidTopology
+	}
+
+	coords := make([]interface{}, 0)
+	for _, idx := range indexes {
+		f, ok := idx.(float64)
+		if !ok {
+			return nil, errInvalidTopology
+		}
+
+		i := int(f)
+		reversed := i < 0
+		if reversed {
+			i = ^i
+		}
+		if i >= len(t.arcs) {
+			return nil, errInvalidTopology
+		}
+
+		arc := t.arcs[i]
+		if reversed {
+			arc = reverseRing(arc)
+		}
+		if len(coords) > 0 && len(arc) > 0 {
+			arc = arc[1:]
+		}
+
+		for _, pos := range arc {
+			// copy each position, since arcs are shared and positions get reprojected in place
+			coords = append(coords, append([]interface{}(nil), pos.([]interface{})...))
+		}
+	}
+	return coords, nil
+}
+
+// each decodes each of the items in an array with fn.
+func (t *topology) each(v interface{}, fn func(interface{}) (interface{}, error)) (interface{}, error) {
+	a, ok := v.([]interface{})
+	if !ok {
+		return nil, errInvalidTopology
+	}
+
+	items := make([]interface{}, len(a))
+	for i, item := range a {
+		var err error
+		if items[i], err = fn(item); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// topojsonPosition copies a position, checking that it has at least two numbers in it.
+func topojsonPosition(v interface{}) ([]interface{}, bool) {
+	a, ok := v.([]interface{})
+	if !ok || len(a) < 2 {
+		return nil, false
+	}
+
+	pos := make([]interface{}, len(a))
+	for i, n := range a {
+		if _, ok := n.(float64); !ok {
+			return nil, false
+		}
+		pos[i] = n
+	}
+	return pos, true
+}
+
+// topojsonPair reads an array of two numbers, such as a transform's scale.
+func topojsonPair(v interface{}) ([2]float64, bool) {
+	a, ok := v.([]interface{})
+	if !ok || len(a) != 2 {
+		return [2]float64{}, false
+	}
+
+	x, xok := a[0].(float64)
+	y, yok := a[1].(float64)
+	return [2]float64{x, y}, xok && yok
+}
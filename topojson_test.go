@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestTopojsonGeos(t *testing.T) {
+	// two squares sharing an edge, quantized with a scale of 1 and a translate of (10, 20)
+	var topo map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+		"type": "Topology",
+		"transform": {"scale": [1, 1], "translate": [10, 20]},
+		"arcs": [
+			[[1, 0], [0, 1]],
+			[[1, 1], [-1, 0], [0, -1], [1, 0]],
+			[[1, 0], [1, 0], [0, 1], [-1, 0]]
+		],
+		"objects": {
+			"squares": {
+				"type": "GeometryCollection",
+				"geometries": [
+					{"type": "Polygon", "arcs": [[0, 1]], "properties": {"name": "west"}, "id": "w"},
+					{"type": "Polygon", "arcs": [[2, -1]], "properties": {"name": "east"}},
+					{"type": null}
+				]
+			},
+			"edge": {"type": "LineString", "arcs": [-1]},
+			"capital": {"type": "Point", "coordinates": [1, 1]}
+		}
+	}`), &topo); err != nil {
+		t.Fatal(err)
+	}
+
+	geos, ok := topojsonGeos(topo, make([]interface{}, 0))
+	assert.Equal(t, true, ok)
+
+	pos := func(x, y float64) []interface{} { return newPosition(x, y) }
+	west := newFeature(newGeometry("Polygon", []interface{}{[]interface{}{
+		pos(11, 20), pos(11, 21), pos(10, 21), pos(10, 20), pos(11, 20),
+	}}), map[string]interface{}{"name": "west"})
+	west["id"] = "w"
+
+	testSlicesContainSameGeos(t, []Geo{
+		Geo{
+			Geo:  newFeature(newGeometry("Point", pos(11, 21)), nil),
+			Path: []interface{}{"objects", "capital"},
+		},
+		Geo{
+			Geo:  newFeature(newGeometry("LineString", []interface{}{pos(11, 21), pos(11, 20)}), nil),
+			Path: []interface{}{"objects", "edge"},
+		},
+		Geo{
+			Geo:  west,
+			Path: []interface{}{"objects", "squares", "geometries", 0},
+		},
+		Geo{
+			Geo: newFeature(newGeometry("Polygon", []interface{}{[]interface{}{
+				pos(11, 20), pos(12, 20), pos(12, 21), pos(11, 21), pos(11, 20),
+			}}), map[string]interface{}{"name": "east"}),
+			Path: []interface{}{"objects", "squares", "geometries", 1},
+		},
+	}, geos)
+}
+
+func TestTopojsonRequest(t *testing.T) {
+	// without a transform, with a bad object that's skipped
+	gr := NewGeobinRequest(0, nil, []byte(`{"topo": {
+		"type": "Topology",
+		"arcs": [[[1, 2], [3, 4]]],
+		"objects": {
+			"line": {"type": "MultiLineString", "arcs": [[0]]},
+			"bad": {"type": "LineString", "arcs": [5]}
+		}
+	}}`))
+
+	testSlicesContainSameGeos(t, []Geo{
+		Geo{
+			Geo:  newFeature(newGeometry("MultiLineString", []interface{}{[]interface{}{newPosition(1, 2), newPosition(3, 4)}}), nil),
+			Path: []interface{}{"topo", "objects", "line"},
+		},
+	}, gr.Geo)
+}
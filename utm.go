@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// the WGS84 ellipsoid's semi-major axis, in meters, and flattening
+	wgs84A = 6378137.0
+	wgs84F = 1 / 298.257223563
+	// UTM's scale factor on the central meridian of each zone, and the false easting and
+	// northings that keep its coordinates positive
+	utmK0            = 0.9996
+	utmFalseEasting  = 500000.0
+	utmFalseNorthing = 10000000.0
+)
+
+var errInvalidUTM = errors.New("invalid UTM coordinates")
+
+// utmToWGS84 converts a UTM easting and northing in the given zone and hemisphere to WGS84
+// longitude and latitude, using Krüger's series for the inverse transverse Mercator projection,
+// which is good to well under a millimeter within a zone.
+func utmToWGS84(zone int, north bool, easting, northing float64) (float64, float64) {
+	n := wgs84F / (2 - wgs84F)
+	n2, n3 := n*n, n*n*n
+	a := wgs84A / (1 + n) * (1 + n2/4 + n2*n2/64)
+	beta := [3]float64{n/2 - 2*n2/3 + 37*n3/96, n2/48 + n3/15, 17 * n3 / 480}
+	delta := [3]float64{2*n - 2*n2/3 - 2*n3, 7*n2/3 - 8*n3/5, 56 * n3 / 15}
+
+	if !north {
+		northing -= utmFalseNorthing
+	}
+	xi := northing / (utmK0 * a)
+	eta := (easting - utmFalseEasting) / (utmK0 * a)
+
+	xi1, eta1 := xi, eta
+	for j := 1; j <= 3; j++ {
+		k := float64(2 * j)
+		xi1 -= beta[j-1] * math.Sin(k*xi) * math.Cosh(k*eta)
+		eta1 -= beta[j-1] * math.Cos(k*xi) * math.Sinh(k*eta)
+	}
+
+	chi := math.Asin(math.Sin(xi1) / math.Cosh(eta1))
+	lat := chi
+	for j := 1; j <= 3; j++ {
+		lat += delta[j-1] * math.Sin(float64(2*j)*chi)
+	}
+
+	lng0 := float64(zone*6 - 183)
+	lng := lng0 + math.Atan2(math.Sinh(eta1), math.Cos(xi1))*180/math.Pi
+	return lng, lat * 180 / math.Pi
+}
+
+// utmGeo looks for a UTM position in the given json map, under the keys "zone", "easting",
+// "northing" and optionally "hemisphere", and converts it to a GeoJSON Point. The zone is a
+// number, or a string with a latitude band letter after the number, such as "18S". The
+// hemisphere is "N", "S", "north" or "south". Without a hemisphere, the band says which
+// hemisphere it's in, and without a band it's taken to be north. It returns false if the map
+// doesn't hold a valid UTM position.
+func utmGeo(o map[string]interface{}) (*Geo, bool) {
+	var zone, easting, northing, hemisphere interface{}
+	for k, v := range o {
+		switch strings.ToLower(k) {
+		case "zone":
+			zone = v
+		case "easting":
+			easting = v
+		case "northing":
+			northing = v
+		case "hemisphere":
+			hemisphere = v
+		}
+	}
+
+	e, eok := easting.(float64)
+	n, nok := northing.(float64)
+	if zone == nil || !eok || !nok {
+		return nil, false
+	}
+
+	z, north, err := utmZone(zone, hemisphere)
+	if err != nil {
+		debugLog("Invalid UTM zone:", zone, hemisphere, err)
+		return nil, false
+	}
+
+	lng, lat, err := utmPosition(z, north, e, n)
+	if err != nil {
+		debugLog("Invalid UTM position:", e, n, err)
+		return nil, false
+	}
+
+	geo := newGeometry("Point", newPosition(lng, lat))
+	debugLog("Found UTM position:", geo)
+	return &Geo{Geo: geo}, true
+}
+
+// utmPosition checks that an easting and northing could be in a UTM zone, and converts them to
+// longitude and latitude.
+func utmPosition(zone int, north bool, easting, northing float64) (float64, float64, error) {
+	if easting < 0 || easting > 2*utmFalseEasting || northing < 0 || northing > utmFalseNorthing {
+		return 0, 0, errInvalidUTM
+	}
+
+	lng, lat := utmToWGS84(zone, north, easting, northing)
+	if !lngIsValid(lng) || !latIsValid(lat) {
+		return 0, 0, errPositionOutOfRange
+	}
+	return lng, lat, nil
+}
+
+// utmZone reads a UTM zone number, with an optional latitude band letter, and a hemisphere.
+func utmZone(zone, hemisphere interface{}) (int, bool, error) {
+	var z int
+	var band byte
+	switch v := zone.(type) {
+	case float64:
+		z = int(v)
+		if float64(z) != v {
+			return 0, false, errInvalidUTM
+		}
+	case string:
+		s := strings.ToUpper(strings.TrimSpace(v))
+		if len(s) > 0 && s[len(s)-1] >= 'A' && s[len(s)-1] <= 'Z' {
+			band = s[len(s)-1]
+			s = s[:len(s)-1]
+		}
+
+		var err error
+		if z, err = strconv.Atoi(s); err != nil {
+			return 0, false, errInvalidUTM
+		}
+	default:
+		return 0, false, errInvalidUTM
+	}
+
+	if z < 1 || z > 60 {
+		return 0, false, errInvalidUTM
+	}
+
+	switch h, _ := hemisphere.(string); strings.ToLower(h) {
+	case "n", "north":
+		return z, true, nil
+	case "s", "south":
+		return z, false, nil
+	case "":
+		if band == 0 {
+			return z, true, nil
+		}
+		if _, ok := mgrsBandNorthings[band]; !ok {
+			return 0, false, errInvalidUTM
+		}
+		return z, band >= 'N', nil
+	}
+	return 0, false, errInvalidUTM
+}
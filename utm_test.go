@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+// assertNear checks that two positions are within tolerance degrees of each other.
+func assertNear(t *testing.T, exp, got []float64, tolerance float64) {
+	for i := range exp {
+		if math.Abs(exp[i]-got[i]) > tolerance {
+			t.Errorf("Expected %v to be within %v of %v", got, tolerance, exp)
+			return
+		}
+	}
+}
+
+func TestUTMToWGS84(t *testing.T) {
+	// the Washington Monument
+	lng, lat := utmToWGS84(18, true, 323483, 4306479)
+	assertNear(t, []float64{-77.03524, 38.88946}, []float64{lng, lat}, 1e-5)
+
+	// the central meridian on the equator
+	lng, lat = utmToWGS84(31, true, 500000, 0)
+	assertNear(t, []float64{3, 0}, []float64{lng, lat}, 1e-9)
+	lng, lat = utmToWGS84(31, false, 500000, 10000000)
+	assertNear(t, []float64{3, 0}, []float64{lng, lat}, 1e-9)
+
+	// the southern hemisphere mirrors the northern one
+	lng, lat = utmToWGS84(56, false, 334786, 10000000-4306479)
+	nlng, nlat := utmToWGS84(56, true, 334786, 4306479)
+	assertNear(t, []float64{nlng, -nlat}, []float64{lng, lat}, 1e-9)
+}
+
+func TestUTMZone(t *testing.T) {
+	for _, test := range []struct {
+		zone, hemisphere interface{}
+		z                int
+		north            bool
+	}{
+		{float64(18), nil, 18, true},
+		{float64(18), "S", 18, false},
+		{float64(56), "south", 56, false},
+		{"18", "North", 18, true},
+		{"18S", nil, 18, true},
+		{"56h", nil, 56, false},
+	} {
+		z, north, err := utmZone(test.zone, test.hemisphere)
+		assert.Equal(t, nil, err, test.zone)
+		assert.Equal(t, test.z, z, test.zone)
+		assert.Equal(t, test.north, north, test.zone)
+	}
+
+	for _, test := range [][2]interface{}{
+		{float64(0), nil},
+		{float64(61), nil},
+		{float64(18.5), nil},
+		{"18I", nil},
+		{"eighteen", nil},
+		{float64(18), "up"},
+		{true, nil},
+	} {
+		_, _, err := utmZone(test[0], test[1])
+		assert.Equal(t, errInvalidUTM, err, test)
+	}
+}
+
+func TestParseUTMInRequest(t *testing.T) {
+	gr := NewGeobinRequest(0, nil, []byte(`{
+		"monument": {"zone": 18, "hemisphere": "N", "easting": 323483, "northing": 4306479, "name": "Washington Monument"},
+		"bad": {"zone": 18, "easting": -5, "northing": 4306479}
+	}`))
+
+	assert.Equal(t, 1, len(gr.Geo))
+	assert.Equal(t, []interface{}{"monument"}, gr.Geo[0].Path)
+	coords := gr.Geo[0].Geo["coordinates"].([]interface{})
+	assertNear(t, []float64{-77.03524, 38.88946}, []float64{coords[0].(float64), coords[1].(float64)}, 1e-5)
+}
@@ -0,0 +1,257 @@
+package main
+
+import "fmt"
+
+// The severities of diagnostics. Errors break a MUST in RFC 7946, and warnings break a SHOULD,
+// or use something that RFC 7946 has dropped.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// maxDiagnostics is the most diagnostics we keep for one geo, so that a big FeatureCollection
+// with the same problem in every feature doesn't bloat the request.
+const maxDiagnostics = 100
+
+// Diagnostic is a problem with the GeoJSON of a geo.
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	// a short name for the kind of problem, such as "unclosed-ring"
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// where in the geo the problem is, such as ["features", 2, "geometry", "coordinates", 0]
+	Path []interface{} `json:"path"`
+}
+
+// geojsonValidator collects the diagnostics for a GeoJSON object.
+type geojsonValidator struct {
+	diagnostics []Diagnostic
+}
+
+// validateGeojson checks a GeoJSON object against RFC 7946, returning the problems it finds with
+// it, or nil if there aren't any. It checks that positions have two or three numbers and are in
+// range, that LineStrings have at least two positions, that Polygon rings are closed, have at
+// least four positions and follow the right-hand rule, and that Features and FeatureCollections
+// have the members they should.
+func validateGeojson(o map[string]interface{}) []Diagnostic {
+	v := &geojsonValidator{}
+	v.object(o, make([]interface{}, 0))
+	return v.diagnostics
+}
+
+func (v *geojsonValidator) add(severity, code string, path []interface{}, format string, args ...interface{}) {
+	switch {
+	case len(v.diagnostics) < maxDiagnostics:
+		v.diagnostics = append(v.diagnostics, Diagnostic{
+			Severity: severity,
+			Code:     code,
+			Message:  fmt.Sprintf(format, args...),
+			Path:     path,
+		})
+	case len(v.diagnostics) == maxDiagnostics:
+		v.diagnostics = append(v.diagnostics, Diagnostic{
+			Severity: severityWarning,
+			Code:     "too-many-diagnostics",
+			Message:  fmt.Sprintf("only the first %d problems are listed", maxDiagnostics),
+			Path:     make([]interface{}, 0),
+		})
+	}
+}
+
+// object checks any GeoJSON object: a geometry, Feature or FeatureCollection.
+func (v *geojsonValidator) object(o map[string]interface{}, path []interface{}) {
+	if _, ok := o["crs"]; ok {
+		v.add(severityWarning, "crs-member", appendPath(path, "crs"),
+			"the crs member isn't part of RFC 7946, which only allows WGS84 longitude and latitude")
+	}
+	if bbox, ok := o["bbox"]; ok {
+		v.bbox(bbox, appendPath(path, "bbox"))
+	}
+
+	switch o["type"] {
+	case "Feature":
+		v.feature(o, path)
+	case "FeatureCollection":
+		features, ok := o["features"].([]interface{})
+		if !ok {
+			v.add(severityError, "invalid-features", appendPath(path, "features"),
+				"a FeatureCollection must have an array of features")
+			return
+		}
+
+		for i, f := range features {
+			fp := appendPath(path, "features", i)
+			m, ok := f.(map[string]interface{})
+			if !ok || m["type"] != "Feature" {
+				v.add(severityError, "invalid-feature", fp, "each of the features must be a Feature")
+				continue
+			}
+			v.object(m, fp)
+		}
+	default:
+		v.geometry(o, path)
+	}
+}
+
+// feature checks a Feature's geometry and properties.
+func (v *geojsonValidator) feature(o map[string]interface{}, path []interface{}) {
+	if g, ok := o["geometry"]; !ok {
+		v.add(severityError, "missing-geometry", path, "a Feature must have a geometry member, which may be null")
+	} else if g != nil {
+		m, ok := g.(map[string]interface{})
+		if !ok {
+			v.add(severityError, "invalid-geometry", appendPath(path, "geometry"), "a Feature's geometry must be an object or null")
+		} else {
+			v.object(m, appendPath(path, "geometry"))
+		}
+	}
+
+	if p, ok := o["properties"]; !ok {
+		v.add(severityWarning, "missing-properties", path, "a Feature should have a properties member, which may be null")
+	} else if _, ok := p.(map[string]interface{}); !ok && p != nil {
+		v.add(severityError, "invalid-properties", appendPath(path, "properties"), "a Feature's properties must be an object or null")
+	}
+}
+
+// geometry checks the coordinates of a geometry, or the members of a GeometryCollection.
+func (v *geojsonValidator) geometry(o map[string]interface{}, path []interface{}) {
+	t, _ := o["type"].(string)
+	if t == "GeometryCollection" {
+		geoms, ok := o["geometries"].([]interface{})
+		if !ok {
+			v.add(severityError, "invalid-geometries", appendPath(path, "geometries"),
+				"a GeometryCollection must have an array of geometries")
+			return
+		}
+
+		for i, g := range geoms {
+			gp := appendPath(path, "geometries", i)
+			m, ok := g.(map[string]interface{})
+			if !ok {
+				v.add(severityError, "invalid-geometry", gp, "each of the geometries must be a geometry object")
+				continue
+			}
+			if m["type"] == "GeometryCollection" {
+				v.add(severityWarning, "nested-geometry-collection", gp, "GeometryCollections should not be nested")
+			}
+			v.object(m, gp)
+		}
+		return
+	}
+
+	cp := appendPath(path, "coordinates")
+	coords, ok := o["coordinates"].([]interface{})
+	if !ok {
+		v.add(severityError, "invalid-coordinates", cp, "a %s must have an array of coordinates", t)
+		return
+	}
+
+	switch t {
+	case "Point":
+		v.position(coords, cp)
+	case "MultiPoint":
+		v.each(coords, cp, v.position)
+	case "LineString":
+		v.line(coords, cp)
+	case "MultiLineString":
+		v.each(coords, cp, v.line)
+	case "Polygon":
+		v.polygon(coords, cp)
+	case "MultiPolygon":
+		v.each(coords, cp, v.polygon)
+	}
+}
+
+// each checks each of the items in an array of coordinates with fn.
+func (v *geojsonValidator) each(coords []interface{}, path []interface{}, fn func([]interface{}, []interface{}) bool) bool {
+	valid := true
+	for i, c := range coords {
+		a, ok := c.([]interface{})
+		if !ok {
+			v.add(severityError, "invalid-coordinates", appendPath(path, i), "expected an array of coordinates")
+			valid = false
+			continue
+		}
+		if !fn(a, appendPath(path, i)) {
+			valid = false
+		}
+	}
+	return valid
+}
+
+// position checks a position, returning false if it isn't an array of at least two numbers.
+func (v *geojsonValidator) position(pos []interface{}, path []interface{}) bool {
+	if len(pos) < 2 {
+		v.add(severityError, "short-position", path, "a position must have at least two values, longitude and latitude")
+		return false
+	}
+	for _, n := range pos {
+		if _, ok := n.(float64); !ok {
+			v.add(severityError, "invalid-position", path, "a position must only hold numbers")
+			return false
+		}
+	}
+
+	if len(pos) > 3 {
+		v.add(severityWarning, "extra-position-values", path, "a position should have no more than three values")
+	}
+	if lng := pos[0].(float64); !lngIsValid(lng) {
+		v.add(severityError, "longitude-out-of-range", path, "longitude %v is outside of -180 to 180", lng)
+	}
+	if lat := pos[1].(float64); !latIsValid(lat) {
+		v.add(severityError, "latitude-out-of-range", path, "latitude %v is outside of -90 to 90", lat)
+	}
+	return true
+}
+
+// line checks the positions of a LineString.
+func (v *geojsonValidator) line(coords []interface{}, path []interface{}) bool {
+	valid := v.each(coords, path, v.position)
+	if len(coords) < 2 {
+		v.add(severityError, "short-linestring", path, "a LineString must have at least two positions, but has %d", len(coords))
+		valid = false
+	}
+	return valid
+}
+
+// polygon checks the rings of a Polygon. The first ring is its exterior, which should go
+// counterclockwise, and the rest are holes, which should go clockwise.
+func (v *geojsonValidator) polygon(coords []interface{}, path []interface{}) bool {
+	return v.each(coords, path, func(ring []interface{}, rp []interface{}) bool {
+		if !v.each(ring, rp, v.position) {
+			return false
+		}
+
+		if len(ring) < 4 {
+			v.add(severityError, "short-ring", rp, "a linear ring must have at least four positions, but has %d", len(ring))
+			return false
+		}
+
+		first, last := ring[0].([]interface{}), ring[len(ring)-1].([]interface{})
+		if first[0] != last[0] || first[1] != last[1] {
+			v.add(severityError, "unclosed-ring", rp, "a linear ring's first and last positions must be the same")
+			return false
+		}
+
+		exterior := rp[len(rp)-1] == 0
+		if area := ringArea(ring); exterior && area < 0 {
+			v.add(severityWarning, "clockwise-exterior-ring", rp, "a polygon's exterior ring should go counterclockwise")
+		} else if !exterior && area > 0 {
+			v.add(severityWarning, "counterclockwise-hole", rp, "a polygon's holes should go clockwise")
+		}
+		return true
+	})
+}
+
+// bbox checks that a bounding box has a minimum and maximum for each of two or three dimensions.
+func (v *geojsonValidator) bbox(b interface{}, path []interface{}) {
+	a, ok := b.([]interface{})
+	valid := ok && (len(a) == 4 || len(a) == 6)
+	for i := 0; valid && i < len(a); i++ {
+		_, valid = a[i].(float64)
+	}
+
+	if !valid {
+		v.add(severityError, "invalid-bbox", path, "a bbox must be an array of 4 or 6 numbers")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+// testDiagnosticCodes validates the given GeoJSON and checks the codes and paths of the problems
+// it finds.
+func testDiagnosticCodes(t *testing.T, src string, exp map[string][]interface{}) {
+	var o map[string]interface{}
+	if err := json.Unmarshal([]byte(src), &o); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string][]interface{})
+	for _, d := range validateGeojson(o) {
+		got[d.Code] = d.Path
+	}
+	assert.Equal(t, exp, got, src)
+}
+
+func TestValidateGeojsonValid(t *testing.T) {
+	for _, src := range []string{
+		`{"type": "Point", "coordinates": [-122.68, 45.52, 10]}`,
+		`{"type": "MultiLineString", "coordinates": [[[0, 0], [1, 1]], [[2, 2], [3, 3]]]}`,
+		`{"type": "Polygon", "coordinates": [
+			[[0, 0], [10, 0], [10, 10], [0, 10], [0, 0]],
+			[[2, 2], [2, 8], [8, 8], [8, 2], [2, 2]]
+		]}`,
+		`{"type": "Feature", "geometry": null, "properties": null}`,
+		`{"type": "FeatureCollection", "bbox": [0, 0, 1, 1], "features": [
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [1, 1]}, "properties": {"name": "a"}}
+		]}`,
+		`{"type": "GeometryCollection", "geometries": [{"type": "Point", "coordinates": [1, 1]}]}`,
+	} {
+		testDiagnosticCodes(t, src, map[string][]interface{}{})
+	}
+}
+
+func TestValidateGeojsonProblems(t *testing.T) {
+	testDiagnosticCodes(t, `{"type": "Point", "coordinates": [200, -95, 1, 2]}`, map[string][]interface{}{
+		"extra-position-values":  {"coordinates"},
+		"longitude-out-of-range": {"coordinates"},
+		"latitude-out-of-range":  {"coordinates"},
+	})
+
+	testDiagnosticCodes(t, `{"type": "MultiLineString", "coordinates": [[[0, 0], [1, 1]], [[2, 2]]]}`, map[string][]interface{}{
+		"short-linestring": {"coordinates", 1},
+	})
+
+	testDiagnosticCodes(t, `{"type": "MultiPolygon", "coordinates": [
+		[[[0, 0], [0, 10], [10, 10], [10, 0], [0, 0]], [[2, 2], [8, 2], [8, 8], [2, 8], [2, 2]]],
+		[[[0, 0], [1, 0], [1, 1], [0, 1]]],
+		[[[0, 0], [1, 0], [0, 0]]]
+	]}`, map[string][]interface{}{
+		"clockwise-exterior-ring": {"coordinates", 0, 0},
+		"counterclockwise-hole":   {"coordinates", 0, 1},
+		"unclosed-ring":           {"coordinates", 1, 0},
+		"short-ring":              {"coordinates", 2, 0},
+	})
+
+	testDiagnosticCodes(t, `{
+		"type": "FeatureCollection",
+		"crs": {"type": "name", "properties": {"name": "EPSG:4326"}},
+		"bbox": [0, 0, 1],
+		"features": [
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": ["1", 1]}},
+			{"type": "Feature", "properties": 5},
+			{"type": "Point", "coordinates": [1, 1]}
+		]
+	}`, map[string][]interface{}{
+		"crs-member":         {"crs"},
+		"invalid-bbox":       {"bbox"},
+		"invalid-position":   {"features", 0, "geometry", "coordinates"},
+		"missing-properties": {"features", 0},
+		"missing-geometry":   {"features", 1},
+		"invalid-properties": {"features", 1, "properties"},
+		"invalid-feature":    {"features", 2},
+	})
+
+	testDiagnosticCodes(t, `{"type": "GeometryCollection", "geometries": [
+		{"type": "GeometryCollection", "geometries": []},
+		{"type": "LineString", "coordinates": 5}
+	]}`, map[string][]interface{}{
+		"nested-geometry-collection": {"geometries", 0},
+		"invalid-coordinates":        {"geometries", 1, "coordinates"},
+	})
+}
+
+func TestValidateGeojsonTooManyProblems(t *testing.T) {
+	coords := make([]interface{}, 150)
+	for i := range coords {
+		coords[i] = []interface{}{float64(500), float64(0)}
+	}
+
+	diagnostics := validateGeojson(map[string]interface{}{"type": "MultiPoint", "coordinates": coords})
+	assert.Equal(t, maxDiagnostics+1, len(diagnostics))
+	assert.Equal(t, "too-many-diagnostics", diagnostics[maxDiagnostics].Code)
+}
+
+func TestParseInvalidGeojsonInRequest(t *testing.T) {
+	gr := NewGeobinRequest(0, nil, []byte(`{"area": {"type": "Polygon", "coordinates": [[[0, 0], [0, 1], [1, 1], [1, 0]]]}}`))
+
+	// the polygon is still found, so that it can be drawn, along with what's wrong with it
+	assert.Equal(t, 1, len(gr.Geo))
+	assert.Equal(t, []interface{}{"area"}, gr.Geo[0].Path)
+	assert.Equal(t, []Diagnostic{
+		Diagnostic{
+			Severity: severityError,
+			Code:     "unclosed-ring",
+			Message:  "a linear ring's first and last positions must be the same",
+			Path:     []interface{}{"coordinates", 0},
+		},
+	}, gr.Geo[0].Diagnostics)
+}
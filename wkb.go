@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// the flags EWKB sets in the high bits of a geometry type
+const (
+	ewkbZ    = 0x80000000
+	ewkbM    = 0x40000000
+	ewkbSRID = 0x20000000
+)
+
+// wkbTypes maps the WKB geometry type codes to their GeoJSON types.
+var wkbTypes = map[uint32]string{
+	1: "Point",
+	2: "LineString",
+	3: "Polygon",
+	4: "MultiPoint",
+	5: "MultiLineString",
+	6: "MultiPolygon",
+	7: "GeometryCollection",
+}
+
+var (
+	errNotWKB   = errors.New("not a hex WKB geometry")
+	errEmptyWKB = errors.New("empty WKB geometry")
+)
+
+// wkbMaxDepth limits how deeply geometries can be nested in a WKB geometry.
+const wkbMaxDepth = 32
+
+// isHexWKB quickly checks whether s looks like a hex encoded WKB geometry, so that most strings
+// can be ruled out without trying to decode them. The smallest geometry worth decoding is a
+// point, at 21 bytes.
+func isHexWKB(s string) bool {
+	if len(s) < 42 || len(s)%2 != 0 || s[0] != '0' || (s[1] != '0' && s[1] != '1') {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseHexWKB converts a hex encoded WKB or EWKB geometry, like the ones PostGIS outputs, to a
+// GeoJSON geometry. It also returns the SRID from the EWKB header, or zero if there isn't one.
+// Both EWKB and ISO WKB dimensions are understood. Z values are kept as a third coordinate,
+// while M values are dropped.
+func parseHexWKB(s string) (map[string]interface{}, int, error) {
+	if !isHexWKB(s) {
+		return nil, 0, errNotWKB
+	}
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, 0, errNotWKB
+	}
+
+	r := &wkbReader{b: b}
+	geo, err := r.geometry()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if r.pos != len(r.b) {
+		return nil, 0, fmt.Errorf("invalid WKB: %d bytes left over", len(r.b)-r.pos)
+	}
+	return geo, r.srid, nil
+}
+
+// wkbReader decodes WKB geometries.
+type wkbReader struct {
+	b     []byte
+	pos   int
+	srid  int
+	depth int
+}
+
+var errWKBTooShort = errors.New("invalid WKB: too short")
+
+func (r *wkbReader) uint32(order binary.ByteOrder) (uint32, error) {
+	if len(r.b)-r.pos < 4 {
+		return 0, errWKBTooShort
+	}
+	v := order.Uint32(r.b[r.pos:])
+	r.pos += 4
+	return v, nil
+}
+
+func (r *wkbReader) float64(order binary.ByteOrder) (float64, error) {
+	if len(r.b)-r.pos < 8 {
+		return 0, errWKBTooShort
+	}
+	v := math.Float64frombits(order.Uint64(r.b[r.pos:]))
+	r.pos += 8
+	return v, nil
+}
+
+// count reads the number of items that follow, checking that there's room left for that many
+// items of at least size bytes each so that a bad count can't make us allocate too much.
+func (r *wkbReader) count(order binary.ByteOrder, size int) (int, error) {
+	n, err := r.uint32(order)
+	if err != nil {
+		return 0, err
+	}
+	if int64(n)*int64(size) > int64(len(r.b)-r.pos) {
+		return 0, errWKBTooShort
+	}
+	return int(n), nil
+}
+
+func (r *wkbReader) geometry() (map[string]interface{}, error) {
+	if r.depth++; r.depth > wkbMaxDepth {
+		return nil, errors.New("invalid WKB: geometries nested too deeply")
+	}
+	defer func() { r.depth-- }()
+
+	if len(r.b)-r.pos < 1 {
+		return nil, errWKBTooShort
+	}
+
+	var order binary.ByteOrder
+	switch r.b[r.pos] {
+	case 0:
+		order = binary.BigEndian
+	case 1:
+		order = binary.LittleEndian
+	default:
+		return nil, errors.New("invalid WKB: bad byte order")
+	}
+	r.pos++
+
+	code, err := r.uint32(order)
+	if err != nil {
+		return nil, err
+	}
+
+	hasZ, hasM := code&ewkbZ != 0, code&ewkbM != 0
+	if code&ewkbSRID != 0 {
+		srid, err := r.uint32(order)
+		if err != nil {
+			return nil, err
+		}
+		if r.srid == 0 {
+			r.srid = int(srid)
+		}
+	}
+
+	// ISO WKB adds 1000, 2000 or 3000 to the type for Z, M and ZM instead of using flags
+	code &^= ewkbZ | ewkbM | ewkbSRID
+	switch code / 1000 {
+	case 1:
+		hasZ = true
+	case 2:
+		hasM = true
+	case 3:
+		hasZ, hasM = true, true
+	}
+
+	t, ok := wkbTypes[code%1000]
+	if !ok || code >= 4000 {
+		return nil, fmt.Errorf("invalid WKB: unknown geometry type %d", code)
+	}
+
+	dims := 2
+	if hasZ {
+		dims++
+	}
+	if hasM {
+		dims++
+	}
+
+	position := func() (interface{}, error) {
+		vals := make([]interface{}, 0, 3)
+		for i := 0; i < dims; i++ {
+			v, err := r.float64(order)
+			if err != nil {
+				return nil, err
+			}
+
+			// keep x, y and z but not m, which is always last
+			if i < 2 || (i == 2 && hasZ) {
+				vals = append(vals, v)
+			}
+		}
+		return vals, nil
+	}
+
+	positions := func() (interface{}, error) {
+		n, err := r.count(order, dims*8)
+		if err != nil {
+			return nil, err
+		}
+
+		ps := make([]interface{}, n)
+		for i := range ps {
+			if ps[i], err = position(); err != nil {
+				return nil, err
+			}
+		}
+		return ps, nil
+	}
+
+	// members reads the geometries in a multi geometry or collection, which each have their
+	// own header
+	members := func(memberType string) ([]interface{}, error) {
+		n, err := r.count(order, 5)
+		if err != nil {
+			return nil, err
+		}
+
+		ms := make([]interface{}, n)
+		for i := range ms {
+			g, err := r.geometry()
+			if err != nil {
+				return nil, err
+			}
+
+			if memberType == "" {
+				ms[i] = g
+			} else if g["type"] != memberType {
+				return nil, fmt.Errorf("invalid WKB: %s in a %s", g["type"], t)
+			} else {
+				ms[i] = g["coordinates"]
+			}
+		}
+		return ms, nil
+	}
+
+	var coords interface{}
+	switch t {
+	case "Point":
+		coords, err = position()
+		if err == nil {
+			pos := coords.([]interface{})
+			if math.IsNaN(pos[0].(float64)) && math.IsNaN(pos[1].(float64)) {
+				err = errEmptyWKB
+			}
+		}
+	case "LineString":
+		coords, err = positions()
+	case "Polygon":
+		var n int
+		if n, err = r.count(order, 4); err == nil {
+			rings := make([]interface{}, n)
+			for i := 0; i < n && err == nil; i++ {
+				rings[i], err = positions()
+			}
+			coords = rings
+		}
+	case "MultiPoint":
+		coords, err = members("Point")
+	case "MultiLineString":
+		coords, err = members("LineString")
+	case "MultiPolygon":
+		coords, err = members("Polygon")
+	case "GeometryCollection":
+		geoms, err := members("")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": t, "geometries": geoms}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"type": t, "coordinates": coords}, nil
+}
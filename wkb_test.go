@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestParseHexWKB(t *testing.T) {
+	tests := []struct {
+		wkb     string
+		srid    int
+		geojson string
+	}{
+		{"0101000020E6100000000000000000F03F0000000000000040", 4326, `{"type":"Point","coordinates":[1,2]}`},
+		{"0000000001c05ea000000000004046a00000000000", 0, `{"type":"Point","coordinates":[-122.5,45.25]}`},
+		{
+			"01020000a0e610000002000000000000000000f03f00000000000000400000000000000840000000000000104000000000000014400000000000001840",
+			4326, `{"type":"LineString","coordinates":[[1,2,3],[4,5,6]]}`,
+		},
+		{
+			"01ba0b000002000000000000000000f03f0000000000000040000000000000084000000000000022400000000000001040000000000000144000000000000018400000000000002240",
+			0, `{"type":"LineString","coordinates":[[1,2,3],[4,5,6]]}`,
+		},
+		{
+			"01030000400100000004000000000000000000000000000000000000000000000000001c40000000000000f03f00000000000000000000000000001c40000000000000f03f000000000000f03f0000000000001c40000000000000000000000000000000000000000000001c40",
+			0, `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}`,
+		},
+		{
+			"0104000020e6100000020000000101000000000000000000f03f0000000000000040010100000000000000000008400000000000001040",
+			4326, `{"type":"MultiPoint","coordinates":[[1,2],[3,4]]}`,
+		},
+		{
+			"01050000000100000001020000000200000000000000000000000000000000000000000000000000f03f000000000000f03f",
+			0, `{"type":"MultiLineString","coordinates":[[[0,0],[1,1]]]}`,
+		},
+		{
+			"0106000000010000000103000000010000000400000000000000000000000000000000000000000000000000f03f0000000000000000000000000000f03f000000000000f03f00000000000000000000000000000000",
+			0, `{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]]]}`,
+		},
+		{
+			"0107000020e6100000020000000101000000000000000000f03f000000000000004001020000000200000000000000000000000000000000000000000000000000f03f000000000000f03f",
+			4326, `{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[1,2]},{"type":"LineString","coordinates":[[0,0],[1,1]]}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		var exp map[string]interface{}
+		if err := json.Unmarshal([]byte(test.geojson), &exp); err != nil {
+			t.Fatal(err)
+		}
+
+		got, srid, err := parseHexWKB(test.wkb)
+		assert.Equal(t, nil, err, test.wkb)
+		assert.Equal(t, test.srid, srid, test.wkb)
+		assert.Equal(t, exp, got, test.wkb)
+	}
+}
+
+func TestParseHexWKBInvalid(t *testing.T) {
+	for _, s := range []string{
+		// empty point
+		"0101000000000000000000f87f000000000000f87f",
+		// more points than there are bytes for
+		"0102000000e803000000000000000000000000000000000000000000000000f03f000000000000f03f",
+		// a linestring in a multipoint
+		"01040000000100000001020000000200000000000000000000000000000000000000000000000000f03f000000000000f03f",
+		// trailing bytes
+		"0101000020E6100000000000000000F03F000000000000004000",
+		// unknown type
+		"0109000000000000000000f03f0000000000000040",
+	} {
+		_, _, err := parseHexWKB(s)
+		assert.NotEqual(t, nil, err, s)
+	}
+
+	for _, s := range []string{
+		"",
+		"0101",
+		"da39a3ee5e6b4b0d3255bfef95601890afd80709",
+		"0101000020E6100000000000000000F03F000000000000004G",
+	} {
+		_, _, err := parseHexWKB(s)
+		assert.Equal(t, errNotWKB, err, s)
+	}
+}
+
+func TestParseHexWKBInRequest(t *testing.T) {
+	gr := NewGeobinRequest(0, nil, []byte(`{
+		"wgs84": "0101000020E6100000000000000000F03F0000000000000040",
+		"mercator": "0101000020110f000000000020fcfd69c1000000c08dc35541",
+		"osgb": "0101000020346c000000000000a02c20410000000000f90541",
+		"bad": "010100000000000000000069400000000000000040"
+	}`))
+
+	assert.Equal(t, 3, len(gr.Geo))
+	for _, g := range gr.Geo {
+		coords := g.Geo["coordinates"].([]interface{})
+		switch g.Path[0] {
+		case "wgs84":
+			assert.Equal(t, "", g.CRS)
+			assert.Equal(t, []interface{}{float64(1), float64(2)}, coords)
+		case "mercator":
+			assert.Equal(t, "EPSG:3857", g.CRS)
+			assert.Equal(t, false, g.Untransformed)
+			assert.T(t, math.Abs(coords[0].(float64)+122.4167) < 0.001, coords)
+			assert.T(t, math.Abs(coords[1].(float64)-45.5295) < 0.001, coords)
+		case "osgb":
+			assert.Equal(t, "EPSG:27700", g.CRS)
+			assert.Equal(t, true, g.Untransformed)
+			assert.Equal(t, []interface{}{float64(530000), float64(180000)}, coords)
+		default:
+			t.Errorf("unexpected geo at %v", g.Path)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// wktTypes maps the WKT geometry keywords to the GeoJSON types they become.
+var wktTypes = map[string]string{
+	"POINT":              "Point",
+	"LINESTRING":         "LineString",
+	"POLYGON":            "Polygon",
+	"MULTIPOINT":         "MultiPoint",
+	"MULTILINESTRING":    "MultiLineString",
+	"MULTIPOLYGON":       "MultiPolygon",
+	"GEOMETRYCOLLECTION": "GeometryCollection",
+}
+
+var (
+	errNotWKT   = errors.New("not a WKT geometry")
+	errEmptyWKT = errors.New("empty WKT geometry")
+)
+
+// ewktSRIDPattern matches the SRID that EWKT, as PostGIS's ST_AsEWKT outputs, starts with.
+var ewktSRIDPattern = regexp.MustCompile(`(?i)^\s*SRID=(\d{1,9});`)
+
+// isWKT quickly checks whether s starts with a WKT geometry keyword, so that most strings can be
+// ruled out without trying to parse them.
+func isWKT(s string) bool {
+	s = strings.TrimLeft(s, " \t\r\n")
+	i := 0
+	for i < len(s) && isASCIILetter(s[i]) {
+		i++
+	}
+	_, ok := wktTypes[strings.ToUpper(s[:i])]
+	return ok
+}
+
+// parseWKT converts a Well-Known Text geometry to a GeoJSON geometry. Z values are kept as a
+// third coordinate, while M values are dropped since GeoJSON has nowhere to put them. Every
+// position must be a valid longitude and latitude.
+func parseWKT(s string) (map[string]interface{}, error) {
+	return parseWKTGeometry(s, false)
+}
+
+// parseEWKT converts an EWKT geometry, which is WKT with an optional "SRID=3857;" prefix, to a
+// GeoJSON geometry. It also returns the SRID, or zero if there isn't one. When there is, the
+// positions aren't checked here, as they needn't be longitudes and latitudes until they've been
+// projected.
+func parseEWKT(s string) (map[string]interface{}, int, error) {
+	m := ewktSRIDPattern.FindStringSubmatch(s)
+	if m == nil {
+		geo, err := parseWKTGeometry(s, false)
+		return geo, 0, err
+	}
+
+	srid, _ := strconv.Atoi(m[1])
+	geo, err := parseWKTGeometry(s[len(m[0]):], true)
+	if err != nil {
+		return nil, 0, err
+	}
+	return geo, srid, nil
+}
+
+// parseWKTGeometry does the work of parseWKT and parseEWKT. Positions are only checked to be
+// valid longitudes and latitudes if they aren't projected.
+func parseWKTGeometry(s string, projected bool) (map[string]interface{}, error) {
+	if !isWKT(s) {
+		return nil, errNotWKT
+	}
+
+	p := &wktParser{s: s, projected: projected}
+	geo, err := p.geometry()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.skipSpace(); p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return geo, nil
+}
+
+// wktParser is a recursive descent parser for WKT geometries.
+type wktParser struct {
+	s   string
+	pos int
+	// how many values the positions in the current geometry have, zero if it isn't known yet,
+	// and whether the last of them is an M value
+	dims  int
+	hasM  bool
+	depth int
+	// whether positions are in some other coordinate reference system, rather than longitude and
+	// latitude
+	projected bool
+}
+
+// wktMaxDepth limits how deeply geometry collections can be nested.
+const wktMaxDepth = 32
+
+func (p *wktParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid WKT at %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *wktParser) skipSpace() {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// peek returns the next byte that isn't whitespace, or 0 at the end of the string.
+func (p *wktParser) peek() byte {
+	if p.skipSpace(); p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *wktParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+// word reads the next keyword, upper cased.
+func (p *wktParser) word() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && isASCIILetter(p.s[p.pos]) {
+		p.pos++
+	}
+	return strings.ToUpper(p.s[start:p.pos])
+}
+
+func (p *wktParser) number() (float64, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte("+-.0123456789eE", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+
+	v, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+	if err != nil {
+		p.pos = start
+		return 0, p.errorf("expected a number")
+	}
+	return v, nil
+}
+
+// list reads a parenthesised, comma separated list, calling item to read each item in it.
+func (p *wktParser) list(item func() (interface{}, error)) ([]interface{}, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	items := make([]interface{}, 0)
+	for {
+		v, err := item()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+
+	if err := p.expect(')'); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (p *wktParser) geometry() (map[string]interface{}, error) {
+	kw := p.word()
+	t, ok := wktTypes[kw]
+	if !ok {
+		return nil, p.errorf("unknown geometry type %q", kw)
+	}
+
+	p.dims, p.hasM = 0, false
+	if p.peek() != '(' {
+		switch p.word() {
+		case "Z":
+			p.dims = 3
+		case "M":
+			p.dims, p.hasM = 3, true
+		case "ZM":
+			p.dims, p.hasM = 4, true
+		case "EMPTY":
+			return nil, errEmptyWKT
+		default:
+			return nil, p.errorf("expected a dimension or '('")
+		}
+	}
+
+	if t == "GeometryCollection" {
+		if p.depth++; p.depth > wktMaxDepth {
+			return nil, p.errorf("geometry collections nested too deeply")
+		}
+		geoms, err := p.list(func() (interface{}, error) { return p.geometry() })
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": t, "geometries": geoms}, nil
+	}
+
+	var coords interface{}
+	var err error
+	switch t {
+	case "Point":
+		coords, err = p.point()
+	case "LineString":
+		coords, err = p.list(p.position)
+	case "Polygon":
+		coords, err = p.list(p.positions)
+	case "MultiPoint":
+		coords, err = p.list(p.multiPointMember)
+	case "MultiLineString":
+		coords, err = p.list(p.positions)
+	case "MultiPolygon":
+		coords, err = p.list(func() (interface{}, error) { return p.list(p.positions) })
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"type": t, "coordinates": coords}, nil
+}
+
+// point reads a parenthesised position.
+func (p *wktParser) point() (interface{}, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	pos, err := p.position()
+	if err != nil {
+		return nil, err
+	}
+	return pos, p.expect(')')
+}
+
+// multiPointMember reads a point in a MULTIPOINT, which may or may not be parenthesised.
+func (p *wktParser) multiPointMember() (interface{}, error) {
+	if p.peek() == '(' {
+		return p.point()
+	}
+	return p.position()
+}
+
+// positions reads a parenthesised list of positions.
+func (p *wktParser) positions() (interface{}, error) {
+	return p.list(p.position)
+}
+
+// position reads the space separated values of a single position.
+func (p *wktParser) position() (interface{}, error) {
+	vals := make([]float64, 0, 4)
+	for c := p.peek(); c != ',' && c != ')' && c != 0; c = p.peek() {
+		v, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+
+	if len(vals) < 2 || len(vals) > 4 || (p.dims != 0 && len(vals) != p.dims) {
+		return nil, p.errorf("position has %d values", len(vals))
+	}
+
+	// without a dimension to say otherwise, a fourth value must be M
+	if p.hasM || len(vals) == 4 {
+		vals = vals[:len(vals)-1]
+	}
+
+	if !p.projected && (!lngIsValid(vals[0]) || !latIsValid(vals[1])) {
+		return nil, p.errorf("position out of range")
+	}
+
+	pos := make([]interface{}, len(vals))
+	for i, v := range vals {
+		pos[i] = v
+	}
+	return pos, nil
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestParseWKT(t *testing.T) {
+	tests := []struct {
+		wkt, geojson string
+	}{
+		{`POINT (30 10)`, `{"type":"Point","coordinates":[30,10]}`},
+		{`point(30.5 -10.25)`, `{"type":"Point","coordinates":[30.5,-10.25]}`},
+		{`POINT Z (30 10 5)`, `{"type":"Point","coordinates":[30,10,5]}`},
+		{`POINT M (30 10 5)`, `{"type":"Point","coordinates":[30,10]}`},
+		{`POINT ZM (30 10 5 1)`, `{"type":"Point","coordinates":[30,10,5]}`},
+		{`POINT (30 10 5 1)`, `{"type":"Point","coordinates":[30,10,5]}`},
+		{`LINESTRING (30 10, 10 30, 40 40)`, `{"type":"LineString","coordinates":[[30,10],[10,30],[40,40]]}`},
+		{
+			`POLYGON ((35 10, 45 45, 15 40, 10 20, 35 10), (20 30, 35 35, 30 20, 20 30))`,
+			`{"type":"Polygon","coordinates":[[[35,10],[45,45],[15,40],[10,20],[35,10]],[[20,30],[35,35],[30,20],[20,30]]]}`,
+		},
+		{`MULTIPOINT ((10 40), (40 30))`, `{"type":"MultiPoint","coordinates":[[10,40],[40,30]]}`},
+		{`MULTIPOINT (10 40, 40 30)`, `{"type":"MultiPoint","coordinates":[[10,40],[40,30]]}`},
+		{
+			`MULTILINESTRING ((10 10, 20 20), (40 40, 30 30))`,
+			`{"type":"MultiLineString","coordinates":[[[10,10],[20,20]],[[40,40],[30,30]]]}`,
+		},
+		{
+			`MULTIPOLYGON (((30 20, 45 40, 10 40, 30 20)), ((15 5, 40 10, 10 20, 15 5)))`,
+			`{"type":"MultiPolygon","coordinates":[[[[30,20],[45,40],[10,40],[30,20]]],[[[15,5],[40,10],[10,20],[15,5]]]]}`,
+		},
+		{
+			`GEOMETRYCOLLECTION (POINT Z (40 10 1), LINESTRING (10 10, 20 20))`,
+			`{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[40,10,1]},{"type":"LineString","coordinates":[[10,10],[20,20]]}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		var exp map[string]interface{}
+		if err := json.Unmarshal([]byte(test.geojson), &exp); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := parseWKT(test.wkt)
+		assert.Equal(t, nil, err, test.wkt)
+		assert.Equal(t, exp, got, test.wkt)
+	}
+}
+
+func TestParseWKTInvalid(t *testing.T) {
+	for _, s := range []string{
+		"hello world",
+		"Pointless",
+		"POINT",
+		"POINT EMPTY",
+		"POINT (30)",
+		"POINT (30 10",
+		"POINT (30 10) trailing",
+		"POINT Z (30 10)",
+		"POINT (200 10)",
+		"LINESTRING (30 10, ten 30)",
+		"POLYGON (30 10, 10 30)",
+	} {
+		_, err := parseWKT(s)
+		assert.NotEqual(t, nil, err, s)
+	}
+
+	_, err := parseWKT("The points are fine")
+	assert.Equal(t, errNotWKT, err)
+}
+
+func TestParseWKTInRequest(t *testing.T) {
+	gr := NewGeobinRequest(0, nil, []byte(`{"name": "home", "geom": "POINT (-122.68 45.52)", "rows": ["LINESTRING (0 0, 1 1)"]}`))
+
+	testSlicesContainSameGeos(t, []Geo{
+		Geo{
+			Geo: map[string]interface{}{
+				"type":        "Point",
+				"coordinates": []interface{}{-122.68, 45.52},
+			},
+			Path: []interface{}{"geom"},
+		},
+		Geo{
+			Geo: map[string]interface{}{
+				"type":        "LineString",
+				"coordinates": []interface{}{[]interface{}{float64(0), float64(0)}, []interface{}{float64(1), float64(1)}},
+			},
+			Path: []interface{}{"rows", 0},
+		},
+	}, gr.Geo)
+}
+
+func TestParseEWKT(t *testing.T) {
+	geo, srid, err := parseEWKT("SRID=3857;POINT(-13627361 5705271)")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, sridWebMercator, srid)
+	assert.Equal(t, []interface{}{float64(-13627361), float64(5705271)}, geo["coordinates"])
+
+	_, srid, err = parseEWKT("POINT (30 10)")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, srid)
+
+	_, _, err = parseEWKT("SRID=4326;")
+	assert.Equal(t, errNotWKT, err)
+}
+
+func TestParseEWKTInRequest(t *testing.T) {
+	gr := NewGeobinRequest(0, nil, []byte(`{
+		"wgs84": "SRID=4326;POINT(-122.68 45.52)",
+		"mercator": "SRID=3857;POINT(-13627361 5705271)",
+		"osgb": "srid=27700;POINT(530000 180000)",
+		"bad": "SRID=4326;POINT(200 10)"
+	}`))
+
+	assert.Equal(t, 3, len(gr.Geo))
+	for _, g := range gr.Geo {
+		coords := g.Geo["coordinates"].([]interface{})
+		switch g.Path[0] {
+		case "wgs84":
+			assert.Equal(t, "", g.CRS)
+			assert.Equal(t, []interface{}{-122.68, 45.52}, coords)
+		case "mercator":
+			assert.Equal(t, "EPSG:3857", g.CRS)
+			assert.Equal(t, false, g.Untransformed)
+			assert.T(t, math.Abs(coords[0].(float64)+122.4167) < 0.001, coords)
+			assert.T(t, math.Abs(coords[1].(float64)-45.5295) < 0.001, coords)
+		case "osgb":
+			assert.Equal(t, "EPSG:27700", g.CRS)
+			assert.Equal(t, true, g.Untransformed)
+			assert.Equal(t, []interface{}{float64(530000), float64(180000)}, coords)
+		default:
+			t.Errorf("unexpected geo at %v", g.Path)
+		}
+	}
+}